@@ -0,0 +1,89 @@
+//go:build !solution
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"gitlab.com/slon/shad-go/gitfame/pkg/gitfame"
+)
+
+func newAgeCmd(opts *options) *cobra.Command {
+	var (
+		buckets string
+		fromNow bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "age",
+		Short: "Break the lines of the authors down by age",
+		Long: `Attribute every line of the repository files to the last commit that modified it
+and count the lines of each author by the age of the commit: the time between
+the commit and the commit time of --revision, or the current time with --now.
+
+The default buckets are <1m, 1-6m, 6-12m, 1-2y and >2y.`,
+		Args: noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := applyConfig(cmd, opts); err != nil {
+				return newUsageError("", err)
+			}
+			if len(opts.repositories) != 1 {
+				return newUsageError("--repository", errors.New("age requires a single repository"))
+			}
+			opts.Repository = opts.repositories[0]
+
+			bounds, err := gitfame.ParseAgeBuckets(buckets)
+			if err != nil {
+				return newUsageError("--age-buckets", fmt.Errorf("age-buckets: %w", err))
+			}
+			ageOpts := gitfame.AgeOptions{Buckets: bounds}
+			if fromNow {
+				ageOpts.Now = time.Now()
+			}
+
+			ctx, cancel, err := prepare(cmd.Context(), cmd.ErrOrStderr(), opts)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+
+			report, err := gitfame.RunAge(ctx, opts.Options, ageOpts)
+			if err != nil {
+				return err
+			}
+
+			for _, warning := range report.Warnings {
+				_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "warning: %s\n", warning)
+			}
+			warnSkipped(cmd.ErrOrStderr(), len(report.Skipped))
+			if opts.verbose {
+				for _, f := range report.Skipped {
+					_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "skipped %s: %s\n", f.Path, f.Reason)
+				}
+			}
+
+			if err := gitfame.WriteAges(cmd.OutOrStdout(), opts.format, report); err != nil {
+				return err
+			}
+
+			if report.Partial {
+				return &partialError{err: ctx.Err()}
+			}
+			return nil
+		},
+	}
+
+	addRunFlags(cmd, opts)
+	addAuthorFlags(cmd, opts)
+	addOrderFlag(cmd, opts)
+	cmd.Flags().StringVar(&buckets, "age-buckets", "1m,6m,12m,2y",
+		"comma-separated ascending upper bounds of the age buckets, each a number with a d, w, m or y suffix "+
+			"for days, weeks, months or years; older lines fall into the extra last bucket")
+	cmd.Flags().BoolVar(&fromNow, "now", false, "measure the ages relative to the current time instead of the commit time of --revision")
+
+	return cmd
+}
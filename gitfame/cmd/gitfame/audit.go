@@ -0,0 +1,105 @@
+//go:build !solution
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"gitlab.com/slon/shad-go/gitfame/pkg/gitfame"
+)
+
+func newAuditCmd(opts *options) *cobra.Command {
+	var (
+		auditOpts gitfame.AuditOptions
+		threshold float64
+		handles   string
+		existing  string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "codeowners-audit",
+		Short: "Compare CODEOWNERS with the authorship of the lines",
+		Long: `Compare CODEOWNERS with the blame of the files selected by the filters at --revision.
+
+CODEOWNERS is --codeowners or the first of ` + strings.Join(gitfame.CodeownersLocations, ", ") + `
+at --revision. Every file belongs to the last matching rule. The output has a row per rule
+with the files and lines it applies to, the share of the lines held by its owners and
+the owner of the most lines; rules whose owners hold less than --threshold percent are stale.
+Names of the authors are mapped to the owners with --handles, a file of lines "@handle Full Name",
+owners also hold the lines of the authors with their emails. Teams hold no lines,
+rules with team owners only are never stale.
+The rows of the rules are followed by rows of the files matching no rule or a rule without owners,
+collapsed into the largest directories of such files.`,
+		Args: noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := applyConfig(cmd, opts); err != nil {
+				return newUsageError("", err)
+			}
+			if len(opts.repositories) != 1 {
+				return newUsageError("--repository", errors.New("codeowners-audit requires a single repository"))
+			}
+			opts.Repository = opts.repositories[0]
+
+			if threshold <= 0 || threshold > 100 {
+				return newUsageError("--threshold", fmt.Errorf("threshold %g is not in (0, 100]", threshold))
+			}
+			auditOpts.Threshold = threshold / 100
+
+			var err error
+			if handles != "" {
+				if auditOpts.Handles, err = gitfame.ReadHandles(handles); err != nil {
+					return newUsageError("--handles", err)
+				}
+			}
+			if existing != "" {
+				if auditOpts.Codeowners, err = gitfame.ReadCodeowners(existing); err != nil {
+					return newUsageError("--codeowners", err)
+				}
+			}
+
+			ctx, cancel, err := prepare(cmd.Context(), cmd.ErrOrStderr(), opts)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+
+			report, err := gitfame.RunAudit(ctx, opts.Options, auditOpts)
+			if err != nil {
+				return err
+			}
+
+			for _, warning := range report.Warnings {
+				_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "warning: %s\n", warning)
+			}
+			warnSkipped(cmd.ErrOrStderr(), len(report.Skipped))
+			if opts.verbose {
+				for _, f := range report.Skipped {
+					_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "skipped %s: %s\n", f.Path, f.Reason)
+				}
+			}
+
+			if err := gitfame.WriteAudit(cmd.OutOrStdout(), opts.format, report); err != nil {
+				return err
+			}
+
+			if report.Partial {
+				return &partialError{err: ctx.Err()}
+			}
+			return nil
+		},
+	}
+
+	addRunFlags(cmd, opts)
+	cmd.Flags().Float64Var(&threshold, "threshold", gitfame.DefaultCodeownersThreshold*100,
+		"least percent of the lines of a rule held by its owners for the rule not to be stale")
+	cmd.Flags().StringVar(&handles, "handles", "", "file mapping the names of the authors to the owners")
+	cmd.Flags().StringVar(&existing, "codeowners", "", "CODEOWNERS to audit instead of the one at --revision")
+	_ = cmd.MarkFlagFilename("handles")
+	_ = cmd.MarkFlagFilename("codeowners")
+
+	return cmd
+}
@@ -0,0 +1,143 @@
+//go:build !solution
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"gitlab.com/slon/shad-go/gitfame/pkg/gitfame"
+)
+
+func newCodeownersCmd(opts *options) *cobra.Command {
+	var (
+		ownersOpts gitfame.CodeownersOptions
+		threshold  float64
+		handles    string
+		check      bool
+		existing   string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "codeowners",
+		Short: "Propose CODEOWNERS from the authorship of the lines",
+		Long: `Propose CODEOWNERS for --revision from the blame of the files selected by the filters.
+
+Every directory up to --depth is owned by the authors of at least --threshold percent
+of the lines in its subtree, or by the author of the most lines if there are none.
+Directories owned the same way as their parents get no rules. Names of the authors
+are mapped to the owners with --handles, a file of lines "@handle Full Name".
+Authors without handles own the rules under their emails and are reported in warnings.
+
+With --check the proposal is compared with the existing CODEOWNERS, --codeowners or
+the first of ` + strings.Join(gitfame.CodeownersLocations, ", ") + ` at --revision,
+the different rules are printed and the exit code is 8. Patterns matching the same paths
+are the same, e.g. /dir/, dir/** and /dir/**, but not dir/ that matches at any depth;
+the order of the rules and of the owners does not matter.`,
+		Args: noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := applyConfig(cmd, opts); err != nil {
+				return newUsageError("", err)
+			}
+			if len(opts.repositories) != 1 {
+				return newUsageError("--repository", errors.New("codeowners requires a single repository"))
+			}
+			opts.Repository = opts.repositories[0]
+
+			if existing != "" && !check {
+				return newUsageError("--codeowners", errors.New("--codeowners requires --check"))
+			}
+			if threshold <= 0 || threshold > 100 {
+				return newUsageError("--threshold", fmt.Errorf("threshold %g is not in (0, 100]", threshold))
+			}
+			ownersOpts.Threshold = threshold / 100
+
+			if handles != "" {
+				var err error
+				if ownersOpts.Handles, err = gitfame.ReadHandles(handles); err != nil {
+					return newUsageError("--handles", err)
+				}
+			}
+
+			ctx, cancel, err := prepare(cmd.Context(), cmd.ErrOrStderr(), opts)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+
+			report, err := gitfame.RunCodeowners(ctx, opts.Options, ownersOpts)
+			if err != nil {
+				return err
+			}
+
+			stderr := cmd.ErrOrStderr()
+			for _, warning := range report.Warnings {
+				_, _ = fmt.Fprintf(stderr, "warning: %s\n", warning)
+			}
+			for _, name := range report.Unmapped {
+				_, _ = fmt.Fprintf(stderr, "warning: no handle for %q\n", name)
+			}
+			warnSkipped(stderr, len(report.Skipped))
+			if opts.verbose {
+				for _, f := range report.Skipped {
+					_, _ = fmt.Fprintf(stderr, "skipped %s: %s\n", f.Path, f.Reason)
+				}
+			}
+
+			if !check {
+				if err := gitfame.WriteCodeowners(cmd.OutOrStdout(), opts.format, report); err != nil {
+					return err
+				}
+				if report.Partial {
+					return &partialError{err: ctx.Err()}
+				}
+				return nil
+			}
+			if report.Partial {
+				// The proposal of partial statistics is not checked.
+				return &partialError{err: ctx.Err()}
+			}
+
+			var file *gitfame.CodeownersFile
+			if existing != "" {
+				if file, err = gitfame.ReadCodeowners(existing); err != nil {
+					return newUsageError("--codeowners", err)
+				}
+			} else {
+				if file, err = gitfame.FindCodeowners(ctx, opts.Options); err != nil {
+					return err
+				}
+				if file == nil {
+					_, _ = fmt.Fprintf(stderr, "warning: no CODEOWNERS at %s\n", opts.Revision)
+					file = &gitfame.CodeownersFile{Source: "CODEOWNERS"}
+				}
+			}
+
+			diff := gitfame.DiffCodeowners(report.Rules, file)
+			for _, line := range diff {
+				if _, err := fmt.Fprintln(cmd.OutOrStdout(), line); err != nil {
+					return err
+				}
+			}
+			if len(diff) > 0 {
+				return &checkError{what: file.Source, differences: len(diff)}
+			}
+			return nil
+		},
+	}
+
+	addRunFlags(cmd, opts)
+	cmd.Flags().IntVar(&ownersOpts.Depth, "depth", 2, "depth of the deepest directories getting rules, the root directory is 0")
+	cmd.Flags().Float64Var(&threshold, "threshold", gitfame.DefaultCodeownersThreshold*100,
+		"least percent of the lines of a directory held by its owners")
+	cmd.Flags().StringVar(&handles, "handles", "", "file mapping the names of the authors to the owners")
+	cmd.Flags().BoolVar(&check, "check", false, "print the differences from the existing CODEOWNERS instead and fail on any")
+	cmd.Flags().StringVar(&existing, "codeowners", "", "existing CODEOWNERS for --check instead of the one at --revision")
+	_ = cmd.MarkFlagFilename("handles")
+	_ = cmd.MarkFlagFilename("codeowners")
+
+	return cmd
+}
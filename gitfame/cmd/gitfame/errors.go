@@ -0,0 +1,157 @@
+//go:build !solution
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"gitlab.com/slon/shad-go/gitfame/pkg/gitfame"
+)
+
+// Exit codes of gitfame.
+const (
+	exitFailure            = 1
+	exitUsage              = 2
+	exitUnknownRevision    = 3
+	exitRepositoryNotFound = 4
+	exitGitFailure         = 5
+	exitPartial            = 6
+	exitInterrupted        = 7
+	exitCheckFailed        = 8
+)
+
+// Error formats.
+const (
+	errorFormatText = "text"
+	errorFormatJSON = "json"
+)
+
+// usageError is an invalid command line argument.
+type usageError struct {
+	// arg is the failing argument, e.g. "--format".
+	arg string
+	err error
+}
+
+func (e *usageError) Error() string { return e.err.Error() }
+func (e *usageError) Unwrap() error { return e.err }
+
+func newUsageError(arg string, err error) error {
+	return &usageError{arg: arg, err: err}
+}
+
+// partialError reports the partial statistics printed with --partial-ok.
+type partialError struct {
+	err error
+}
+
+func (e *partialError) Error() string { return "partial results: " + e.err.Error() }
+func (e *partialError) Unwrap() error { return e.err }
+
+// checkError reports the differences found by --check.
+type checkError struct {
+	what        string
+	differences int
+}
+
+func (e *checkError) Error() string {
+	return fmt.Sprintf("%s differs from the proposal in %d lines", e.what, e.differences)
+}
+
+// jsonError is printed to stderr with --error-format=json.
+type jsonError struct {
+	Code     string `json:"code"`
+	ExitCode int    `json:"exit_code"`
+	Message  string `json:"message"`
+	Arg      string `json:"arg"`
+}
+
+// classifyError returns the description of err.
+//
+// Repository and revision errors are checked first,
+// since they are reported through config and option errors too.
+func classifyError(err error) jsonError {
+	e := jsonError{Message: err.Error()}
+
+	var usageErr *usageError
+	var optionErr *gitfame.OptionError
+	var gitErr *gitfame.GitError
+	var partialErr *partialError
+	var checkErr *checkError
+
+	switch {
+	case errors.As(err, &partialErr):
+		e.Code, e.ExitCode, e.Arg = "partial", exitPartial, "--partial-ok"
+	case errors.As(err, &checkErr):
+		e.Code, e.ExitCode, e.Arg = "check_failed", exitCheckFailed, "--check"
+	case errors.Is(err, context.DeadlineExceeded):
+		e.Code, e.ExitCode, e.Arg = "timeout", exitInterrupted, "--timeout"
+	case errors.Is(err, context.Canceled):
+		e.Code, e.ExitCode = "interrupted", exitInterrupted
+	case errors.Is(err, gitfame.ErrRepositoryNotFound):
+		e.Code, e.ExitCode, e.Arg = "repository_not_found", exitRepositoryNotFound, "--repository"
+	case errors.Is(err, gitfame.ErrUnknownRevision):
+		e.Code, e.ExitCode, e.Arg = "unknown_revision", exitUnknownRevision, "--revision"
+	case errors.As(err, &usageErr):
+		e.Code, e.ExitCode, e.Arg = "usage", exitUsage, usageErr.arg
+	case errors.As(err, &optionErr):
+		e.Code, e.ExitCode, e.Arg = "usage", exitUsage, "--"+optionErr.Option
+	case errors.As(err, &gitErr):
+		e.Code, e.ExitCode = "git_failure", exitGitFailure
+	case strings.HasPrefix(e.Message, "required flag(s)"):
+		// Reported by cobra before running the command.
+		e.Code, e.ExitCode, e.Arg = "usage", exitUsage, flagArg(e.Message)
+	default:
+		e.Code, e.ExitCode = "error", exitFailure
+	}
+
+	return e
+}
+
+// reportError prints err to w in the format and returns the exit code.
+func reportError(w io.Writer, format string, err error) int {
+	e := classifyError(err)
+
+	if format == errorFormatJSON {
+		_ = json.NewEncoder(w).Encode(e)
+	} else {
+		_, _ = fmt.Fprintf(w, "Error: %s\n", e.Message)
+	}
+
+	return e.ExitCode
+}
+
+var flagRe = regexp.MustCompile(`--[\w-]+|\B-\w\b`)
+
+// flagArg extracts the flag name from a flag parsing error,
+// e.g. `invalid argument "x" for "--order-by" flag`.
+func flagArg(msg string) string {
+	if m := flagRe.FindString(msg); m != "" {
+		return m
+	}
+	if _, name, ok := strings.Cut(msg, `"`); ok {
+		name, _, _ = strings.Cut(name, `"`)
+		return "--" + name
+	}
+	return ""
+}
+
+func flagError(cmd *cobra.Command, err error) error {
+	return newUsageError(flagArg(err.Error()), err)
+}
+
+// noArgs is cobra.NoArgs reporting the unexpected argument as a usage error.
+func noArgs(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return newUsageError(args[0], fmt.Errorf("unknown command %q for %q", args[0], cmd.CommandPath()))
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+//go:build !solution
+
+package main
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"gitlab.com/slon/shad-go/gitfame/internal/format"
+	"gitlab.com/slon/shad-go/gitfame/internal/languages"
+)
+
+func newLanguagesCmd(opts *options) *cobra.Command {
+	var outputFormat string
+
+	cmd := &cobra.Command{
+		Use:   "languages",
+		Short: "List languages accepted by --languages",
+		Long: `List names, types and extensions of the languages accepted by --languages.
+
+The json output can be edited and passed back with --languages-config.`,
+		Args: noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := format.Validate(outputFormat); err != nil {
+				return newUsageError("--format", err)
+			}
+
+			mapping, err := languages.LoadConfig(opts.LanguagesConfig, opts.LanguagesConfigMerge)
+			if err != nil {
+				return newUsageError("--languages-config", err)
+			}
+
+			return format.WriteLanguages(cmd.OutOrStdout(), outputFormat, mapping.Languages())
+		},
+	}
+
+	cmd.Flags().StringVar(&outputFormat, "format", format.Tabular, "output format, one of "+strings.Join(format.Formats, ", "))
+
+	return cmd
+}
@@ -2,6 +2,426 @@
 
 package main
 
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"gitlab.com/slon/shad-go/gitfame/internal/config"
+	"gitlab.com/slon/shad-go/gitfame/internal/filter"
+	"gitlab.com/slon/shad-go/gitfame/internal/git"
+	"gitlab.com/slon/shad-go/gitfame/pkg/gitfame"
+)
+
+// Rows of the output selected by --emit.
+const (
+	emitAuthors = "authors"
+	emitTriples = "triples"
+)
+
+type options struct {
+	gitfame.Options
+
+	format      string
+	excludeFrom []string
+	progress    bool
+	verbose     bool
+	timeout     time.Duration
+	noConfig    bool
+	sinceState  string
+	saveState   string
+
+	repositories []string
+	manifest     string
+	byRepo       bool
+	emit         string
+	metadata     bool
+	columns      []string
+
+	errorFormat string
+}
+
 func main() {
+	// Interrupting kills the git processes through the context.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cmd := newRootCmd()
+	if err := cmd.ExecuteContext(ctx); err != nil {
+		errorFormat, _ := cmd.PersistentFlags().GetString("error-format")
+		os.Exit(reportError(cmd.ErrOrStderr(), errorFormat, err))
+	}
+}
+
+func newRootCmd() *cobra.Command {
+	var opts options
+
+	cmd := &cobra.Command{
+		Use:   "gitfame",
+		Short: "Calculate authorship statistics of a git repository",
+		Long: `gitfame attributes every line of the repository files to the last commit
+that modified it and reports the number of lines, commits and files per author.`,
+		Args:          noArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if opts.errorFormat != errorFormatText && opts.errorFormat != errorFormatJSON {
+				return newUsageError("--error-format", fmt.Errorf("unknown error format %q", opts.errorFormat))
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := applyConfig(cmd, &opts); err != nil {
+				return newUsageError("", err)
+			}
+			if opts.manifest != "" && !cmd.Flags().Changed("repository") {
+				opts.repositories = nil
+			}
+			return run(cmd.Context(), cmd.OutOrStdout(), cmd.ErrOrStderr(), &opts)
+		},
+	}
+
+	addRunFlags(cmd, &opts)
+	addAuthorFlags(cmd, &opts)
+	addOrderFlag(cmd, &opts)
+
+	flags := cmd.Flags()
+	flags.StringVar(&opts.CommitsFrom, "commits-from", gitfame.CommitsFromBlame,
+		"source of the commits counts, one of "+strings.Join(gitfame.CommitsFromSources, ", ")+
+			"; blame counts the commits owning the lines, log counts the non-merge commits "+
+			"that modified the included files in the history of --revision")
+	flags.StringSliceVar(&opts.columns, "columns", nil,
+		"extra columns breaking the lines down by kind, any of "+strings.Join(gitfame.Columns, ", "))
+	flags.StringVar(&opts.manifest, "manifest", "",
+		"file listing repositories to analyze, one 'path [revision]' per line; "+
+			"used instead of --repository unless it is set explicitly")
+	flags.BoolVar(&opts.byRepo, "by-repo", false, "break the authors down by repository instead of merging them")
+	flags.StringVar(&opts.GroupBy, "group-by", gitfame.GroupByName,
+		"key the authors are merged by, one of "+strings.Join(gitfame.GroupByKeys, ", ")+
+			"; email and domain ignore case and name the authors after the emails or their domains")
+	flags.StringVar(&opts.emit, "emit", emitAuthors,
+		"rows of the output, one of "+emitAuthors+", "+emitTriples+"; triples are (file, author, lines, commits) rows "+
+			"adding up to the authors, --format="+gitfame.FormatMatrixCSV+" is short for --emit="+emitTriples+" --format=csv")
+	flags.BoolVar(&opts.metadata, "metadata", false,
+		"describe the calculation in json formats: json writes an object with metadata and authors fields, "+
+			"json-lines writes a metadata line first")
+	flags.StringVar(&opts.sinceState, "since-state", "",
+		"state file of a previous run, written alongside the output and not the json report; "+
+			"only files changed since its revision are blamed, "+
+			"the file is updated unless --save-state is set")
+	flags.StringVar(&opts.saveState, "save-state", "", "write the state file of this run for a later --since-state")
+	_ = cmd.MarkFlagFilename("manifest")
+	_ = cmd.MarkFlagFilename("since-state", "json")
+	_ = cmd.MarkFlagFilename("save-state", "json")
+
+	persistent := cmd.PersistentFlags()
+	persistent.StringArrayVar(&opts.repositories, "repository", []string{"."},
+		"path to the git repository; repeat to merge the statistics of several repositories")
+	persistent.StringVar(&opts.Revision, "revision", "HEAD", "commit to calculate statistics for")
+	persistent.StringVar(&opts.LanguagesConfig, "languages-config", "",
+		"path to a language mapping in the configs/language_extensions.json format replacing the built-in one")
+	persistent.BoolVar(&opts.LanguagesConfigMerge, "languages-config-merge", false,
+		"merge --languages-config on top of the built-in mapping instead of replacing it")
+	persistent.BoolVar(&opts.noConfig, "no-config", false, "do not look for "+config.FileName)
+	persistent.StringVar(&opts.errorFormat, "error-format", errorFormatText,
+		"format of errors printed to stderr, one of text, json; "+
+			"json errors are objects with code, exit_code, message and arg fields")
+	_ = cmd.MarkPersistentFlagFilename("languages-config", "json")
+
+	cmd.SetFlagErrorFunc(flagError)
+	cmd.AddCommand(newLanguagesCmd(&opts), newAgeCmd(&opts), newSurvivalCmd(&opts), newTimelineCmd(&opts), newCodeownersCmd(&opts), newAuditCmd(&opts), newServeCmd())
+
+	return cmd
+}
+
+// addRunFlags registers the flags selecting and attributing the lines, shared by the commands blaming a revision.
+func addRunFlags(cmd *cobra.Command, opts *options) {
+	addFilterFlags(cmd, opts)
+
+	flags := cmd.Flags()
+	flags.StringVar(&opts.Backend, "backend", gitfame.BackendGit,
+		"way to read the repository, one of "+strings.Join(gitfame.Backends, ", ")+
+			"; go-git does not run git, but ignores the mailmap and does not support "+
+			"--mailmap, --skip-binary, --exclude-commit-message, --commits-from=log and --since-state")
+	flags.StringVar(&opts.ExcludeMode, "exclude-mode", gitfame.ExcludeModeIgnore,
+		"attribution of lines of the excluded commits, one of "+strings.Join(gitfame.ExcludeModes, ", ")+
+			"; ignore attributes them to the previous commits as git blame --ignore-rev, drop drops them")
+	flags.StringVar(&opts.Count, "count", gitfame.CountAll,
+		"kind of lines counted in the Lines column, one of "+strings.Join(gitfame.Counts, ", ")+
+			"; kinds are told apart by the comment syntax of the languages")
+	flags.BoolVar(&opts.progress, "progress", false, "print progress to stderr")
+	flags.BoolVar(&opts.PartialOK, "partial-ok", false,
+		"on timeout or interruption print the statistics of the files blamed so far and exit with code 6")
+	flags.BoolVar(&opts.verbose, "verbose", false, "print skipped files with the reasons to stderr")
+	flags.Var((*sizeValue)(&opts.MaxFileSize), "max-file-size",
+		"skip files larger than SIZE bytes, k, m and g suffixes multiply by powers of 1024, e.g. 512k")
+	flags.BoolVar(&opts.SkipBinary, "skip-binary", false,
+		"skip binary files: the ones with NUL bytes and the ones marked -diff or binary in .gitattributes")
+}
+
+// addOrderFlag registers --order-by, shared by the commands listing the authors of the report as sorted.
+func addOrderFlag(cmd *cobra.Command, opts *options) {
+	cmd.Flags().StringVar(&opts.OrderBy, "order-by", gitfame.OrderByLines,
+		"comma-separated sort keys of lines, commits, files, name, e.g. 'files,+name'; "+
+			"a +/- prefix sets the ascending/descending direction, numbers are descending and names ascending by default")
+}
+
+// addAuthorFlags registers the flags limiting the authors, shared by the commands reporting them.
+func addAuthorFlags(cmd *cobra.Command, opts *options) {
+	flags := cmd.Flags()
+	flags.IntVar(&opts.MinLines, "min-lines", 0, "drop authors with fewer lines")
+	flags.IntVar(&opts.Top, "top", 0, "keep the first N authors and fold the rest into a single "+gitfame.Others+" row")
+}
+
+// addFilterFlags registers the flags selecting the files and the authors, shared by all commands analyzing a revision.
+func addFilterFlags(cmd *cobra.Command, opts *options) {
+	flags := cmd.Flags()
+	flags.BoolVar(&opts.UseCommitter, "use-committer", false, "attribute lines to committers instead of authors")
+	flags.StringVar(&opts.Mailmap, "mailmap", "",
+		"mailmap file mapping the names of the authors and the committers on top of the .mailmap of the repository")
+	flags.StringVar(&opts.format, "format", gitfame.FormatTabular, "output format, one of "+strings.Join(gitfame.Formats(), ", "))
+	flags.StringSliceVar(&opts.Extensions, "extensions", nil, "comma-separated list of file extensions to include, e.g. '.go,.md'")
+	flags.StringSliceVar(&opts.Languages, "languages", nil, "comma-separated list of languages to include, e.g. 'go,markdown'")
+	flags.StringSliceVar(&opts.Exclude, "exclude", nil, "comma-separated patterns of files to exclude")
+	flags.StringArrayVar(&opts.excludeFrom, "exclude-from", nil, "read --exclude patterns from a file, one per line")
+	flags.StringSliceVar(&opts.RestrictTo, "restrict-to", nil, "comma-separated patterns; files matching none of them are excluded")
+	flags.StringVar(&opts.PatternSyntax, "pattern-syntax", gitfame.SyntaxGlob,
+		"syntax of --exclude and --restrict-to patterns, one of "+strings.Join(filter.Syntaxes, ", ")+
+			"; glob patterns match whole paths with path/filepath.Match, "+
+			"gitignore patterns support **, / anchoring, trailing / for directories and ! negations")
+	flags.StringArrayVar(&opts.Paths, "path", nil,
+		"directory relative to the repository root; repeat to limit the files to several subtrees")
+	flags.BoolVar(&opts.StripPath, "strip-path", false,
+		"report paths relative to the single --path; --exclude and --restrict-to match them as well as the full paths")
+	flags.StringVar(&opts.ExcludeCommitMessage, "exclude-commit-message", "",
+		"regular expression; commits with matching messages are excluded from the attribution")
+	flags.DurationVar(&opts.timeout, "timeout", 0, "stop the calculation after the duration, e.g. 5m; zero means no limit")
+	_ = cmd.MarkFlagFilename("exclude-from")
+	_ = cmd.MarkFlagFilename("mailmap")
+}
+
+// applyConfig sets flags missing from the command line to the values of the first
+// config found in the working directory, the repository top-level directory
+// and the tree of the analyzed revision. Keys of flags the command lacks but
+// the root command has are ignored, so that a config serves all commands.
+func applyConfig(cmd *cobra.Command, opts *options) error {
+	if opts.noConfig {
+		return nil
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	c, err := config.ReadDir(wd)
+	if err != nil {
+		return err
+	}
+	if c != nil {
+		return c.Without(foreignFlags(cmd)...).Apply(cmd.Flags(), "no-config")
+	}
+
+	// Configs of several repositories may contradict each other.
+	if len(opts.repositories) != 1 || opts.manifest != "" {
+		return nil
+	}
+
+	// The lookup runs git.
+	if opts.Backend != gitfame.BackendGit {
+		return nil
+	}
+
+	// Repository configs can not redirect the lookup to another repository or revision.
+	c, err = config.FindInRepository(cmd.Context(), git.Open(opts.repositories[0]), opts.Revision)
+	if err != nil || c == nil {
+		return err
+	}
+	return c.Without(foreignFlags(cmd, "manifest")...).Apply(cmd.Flags(), "no-config", "repository", "revision", "manifest")
+}
+
+// foreignFlags returns the names of the flags of the root command missing from cmd,
+// but the kept ones; a config shared by the commands may set them.
+func foreignFlags(cmd *cobra.Command, keep ...string) []string {
+	var names []string
+	cmd.Root().Flags().VisitAll(func(f *pflag.Flag) {
+		if cmd.Flags().Lookup(f.Name) == nil && !slices.Contains(keep, f.Name) {
+			names = append(names, f.Name)
+		}
+	})
+	return names
+}
+
+func run(ctx context.Context, stdout, stderr io.Writer, opts *options) error {
+	var writerOpts []gitfame.WriterOption
+	if opts.metadata {
+		writerOpts = append(writerOpts, gitfame.WithMetadata())
+	}
+	if len(opts.columns) > 0 {
+		writerOpts = append(writerOpts, gitfame.WithColumns(opts.columns...))
+		opts.Classify = true
+	}
+
+	newWriter := gitfame.NewWriter
+	switch {
+	case opts.emit != emitAuthors && opts.emit != emitTriples:
+		return newUsageError("--emit", fmt.Errorf("unknown emit %q", opts.emit))
+	case opts.emit == emitTriples && opts.byRepo:
+		return newUsageError("--emit", errors.New("--emit=triples can not be used with --by-repo"))
+	case opts.emit == emitTriples:
+		newWriter = gitfame.NewTriplesWriter
+	case opts.byRepo:
+		newWriter = gitfame.NewRepositoriesWriter
+	}
+	w, err := newWriter(opts.format, writerOpts...)
+	if err != nil {
+		return err
+	}
+
+	var sources []gitfame.Source
+	for _, path := range opts.repositories {
+		sources = append(sources, gitfame.Source{Path: path})
+	}
+	if opts.manifest != "" {
+		manifest, err := gitfame.ReadManifest(opts.manifest)
+		if err != nil {
+			return newUsageError("--manifest", fmt.Errorf("manifest: %w", err))
+		}
+		sources = append(sources, manifest...)
+	}
+
+	ctx, cancel, err := prepare(ctx, stderr, opts)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	if (opts.sinceState != "" || opts.saveState != "") && len(sources) != 1 {
+		return newUsageError("--since-state", errors.New("--since-state and --save-state require a single repository"))
+	}
+
+	if opts.sinceState != "" {
+		// The first incremental run has nothing to start from.
+		state, err := gitfame.LoadState(opts.sinceState)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return newUsageError("--since-state", fmt.Errorf("since-state: %w", err))
+		}
+		opts.Since = state
+	}
+
+	report, err := gitfame.RunRepositories(ctx, sources, opts.Options)
+	if err != nil {
+		return err
+	}
+
+	if path := cmp.Or(opts.saveState, opts.sinceState); path != "" {
+		if err := report.State.Save(path); err != nil {
+			return fmt.Errorf("save-state: %w", err)
+		}
+	}
+
+	for _, warning := range report.Warnings {
+		_, _ = fmt.Fprintf(stderr, "warning: %s\n", warning)
+	}
+
+	warnSkipped(stderr, len(report.Skipped))
+	if opts.verbose {
+		printSkipped(stderr, report)
+	}
+
+	if err := w.Write(stdout, report); err != nil {
+		return err
+	}
+
+	if report.Partial {
+		return &partialError{err: ctx.Err()}
+	}
+	return nil
+}
+
+// prepare reads the --exclude-from files into the options, sets up the progress
+// and returns ctx limited by --timeout.
+func prepare(ctx context.Context, stderr io.Writer, opts *options) (context.Context, context.CancelFunc, error) {
+	for _, path := range opts.excludeFrom {
+		patterns, err := filter.ReadPatterns(path)
+		if err != nil {
+			return nil, nil, newUsageError("--exclude-from", fmt.Errorf("exclude-from: %w", err))
+		}
+		opts.Exclude = append(opts.Exclude, patterns...)
+	}
+
+	if opts.progress {
+		opts.Progress = progressWriter(stderr)
+	}
+
+	if opts.timeout < 0 {
+		return nil, nil, newUsageError("--timeout", fmt.Errorf("negative timeout %s", opts.timeout))
+	}
+	if opts.timeout > 0 {
+		ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+		return ctx, cancel, nil
+	}
+	return ctx, func() {}, nil
+}
+
+// warnSkipped prints the number of the skipped files if there are any, --verbose lists them.
+func warnSkipped(w io.Writer, n int) {
+	if n > 0 {
+		_, _ = fmt.Fprintf(w, "warning: %d files skipped by --max-file-size or --skip-binary\n", n)
+	}
+}
+
+// printSkipped prints the skipped files, prefixed with the repository name for several repositories.
+func printSkipped(w io.Writer, report *gitfame.Report) {
+	for _, repo := range report.Repositories {
+		for _, f := range repo.Skipped {
+			path := f.Path
+			if len(report.Repositories) > 1 {
+				path = repo.Name + ":" + path
+			}
+			_, _ = fmt.Fprintf(w, "skipped %s: %s\n", path, f.Reason)
+		}
+	}
+}
+
+// sizeValue is the flag of a size in bytes, see gitfame.ParseSize.
+type sizeValue int64
+
+func (v *sizeValue) String() string {
+	return strconv.FormatInt(int64(*v), 10)
+}
+
+func (v *sizeValue) Set(s string) error {
+	n, err := gitfame.ParseSize(s)
+	if err != nil {
+		return err
+	}
+	*v = sizeValue(n)
+	return nil
+}
+
+func (v *sizeValue) Type() string {
+	return "SIZE"
+}
 
+func progressWriter(w io.Writer) func(done, total int) {
+	return func(done, total int) {
+		_, _ = fmt.Fprintf(w, "\rblaming files: %d/%d", done, total)
+		if done == total {
+			_, _ = fmt.Fprintln(w)
+		}
+	}
 }
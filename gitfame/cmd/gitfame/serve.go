@@ -0,0 +1,96 @@
+//go:build !solution
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"gitlab.com/slon/shad-go/gitfame/internal/server"
+)
+
+func newServeCmd() *cobra.Command {
+	var (
+		listen        string
+		reposDir      string
+		cacheSize     int
+		reportTimeout time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve statistics of local repositories over HTTP",
+		Long: `Serve statistics of the repositories located in subdirectories of --repos.
+
+  GET /api/v1/repos/{name}/fame?revision=&format=&languages=...
+
+Query parameters mirror the flags of gitfame, the format defaults to json.
+Reports are cached per resolved commit and carry an ETag for conditional requests.
+A report calculated longer than --report-timeout fails with 504, the calculations
+in progress are cancelled on shutdown.`,
+		Args: noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if reportTimeout < 0 {
+				return newUsageError("--report-timeout", fmt.Errorf("negative timeout %s", reportTimeout))
+			}
+			if fi, err := os.Stat(reposDir); err != nil {
+				return newUsageError("--repos", err)
+			} else if !fi.IsDir() {
+				return newUsageError("--repos", fmt.Errorf("%s is not a directory", reposDir))
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			handler := server.New(reposDir, cacheSize, server.WithReportTimeout(reportTimeout))
+			defer handler.Close()
+
+			srv := &http.Server{
+				Addr:              listen,
+				Handler:           handler,
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+
+			errc := make(chan error, 1)
+			go func() { errc <- srv.ListenAndServe() }()
+
+			select {
+			case err := <-errc:
+				return err
+			case <-ctx.Done():
+			}
+
+			// The requests waiting for the reports fail instead of delaying the shutdown.
+			handler.Close()
+
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			if err := srv.Shutdown(shutdownCtx); err != nil {
+				return err
+			}
+			if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			return nil
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&listen, "listen", ":8080", "address to listen on")
+	flags.StringVar(&reposDir, "repos", "", "directory with repositories to serve, one per subdirectory")
+	flags.IntVar(&cacheSize, "cache-size", 128, "maximum number of cached reports")
+	flags.DurationVar(&reportTimeout, "report-timeout", 5*time.Minute, "maximum time of the calculation of a report, 0 for no limit")
+	_ = cmd.MarkFlagRequired("repos")
+	_ = cmd.MarkFlagDirname("repos")
+
+	return cmd
+}
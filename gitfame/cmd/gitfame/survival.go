@@ -0,0 +1,69 @@
+//go:build !solution
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"gitlab.com/slon/shad-go/gitfame/pkg/gitfame"
+)
+
+func newSurvivalCmd(opts *options) *cobra.Command {
+	var survivalOpts gitfame.SurvivalOptions
+
+	cmd := &cobra.Command{
+		Use:   "survival",
+		Short: "Track how long the lines of each period survive",
+		Long: `Blame the last first-parent commit of every period in the history of --revision
+and track how many lines of the commits of each period, the cohort, are still
+present at the later ones.
+
+Each row is a survival curve of a cohort, an author or all lines: the number of
+lines introduced, the estimated half-life in periods and the shares of the lines
+surviving 0, 1, 2... periods. Every period is blamed, so long histories take long.`,
+		Args: noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := applyConfig(cmd, opts); err != nil {
+				return newUsageError("", err)
+			}
+			if len(opts.repositories) != 1 {
+				return newUsageError("--repository", errors.New("survival requires a single repository"))
+			}
+			opts.Repository = opts.repositories[0]
+
+			ctx, cancel, err := prepare(cmd.Context(), cmd.ErrOrStderr(), opts)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+
+			report, err := gitfame.RunSurvival(ctx, opts.Options, survivalOpts)
+			if err != nil {
+				return err
+			}
+
+			for _, warning := range report.Warnings {
+				_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "warning: %s\n", warning)
+			}
+			warnSkipped(cmd.ErrOrStderr(), len(report.Skipped))
+			if opts.verbose {
+				for _, f := range report.Skipped {
+					_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "skipped %s: %s\n", f.Path, f.Reason)
+				}
+			}
+
+			return gitfame.WriteSurvival(cmd.OutOrStdout(), opts.format, report)
+		},
+	}
+
+	addRunFlags(cmd, opts)
+	addAuthorFlags(cmd, opts)
+	cmd.Flags().StringVar(&survivalOpts.Period, "period", gitfame.PeriodQuarter,
+		"length of the cohorts and the interval between the blamed revisions, one of "+strings.Join(gitfame.SurvivalPeriods, ", "))
+
+	return cmd
+}
@@ -0,0 +1,72 @@
+//go:build !solution
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"gitlab.com/slon/shad-go/gitfame/pkg/gitfame"
+)
+
+func newTimelineCmd(opts *options) *cobra.Command {
+	var (
+		timelineOpts gitfame.TimelineOptions
+		sparkline    bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "timeline",
+		Short: "Count the commits of the authors by week or month",
+		Long: `Count the non-merge commits of each author in the history of --revision by period.
+
+Only commits modifying files selected by the filters count, the files are matched
+by their paths at the commits. The output has a row per period and author,
+with --sparkline the tabular output has a row per author with an ASCII sparkline.`,
+		Args: noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := applyConfig(cmd, opts); err != nil {
+				return newUsageError("", err)
+			}
+			if len(opts.repositories) != 1 {
+				return newUsageError("--repository", errors.New("timeline requires a single repository"))
+			}
+			opts.Repository = opts.repositories[0]
+
+			if sparkline && opts.format != gitfame.FormatTabular {
+				return newUsageError("--sparkline", fmt.Errorf("--sparkline requires --format=%s", gitfame.FormatTabular))
+			}
+
+			ctx, cancel, err := prepare(cmd.Context(), cmd.ErrOrStderr(), opts)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+
+			report, err := gitfame.RunTimeline(ctx, opts.Options, timelineOpts)
+			if err != nil {
+				return err
+			}
+
+			for _, warning := range report.Warnings {
+				_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "warning: %s\n", warning)
+			}
+
+			if sparkline {
+				return gitfame.WriteSparklines(cmd.OutOrStdout(), report)
+			}
+			return gitfame.WriteTimeline(cmd.OutOrStdout(), opts.format, report)
+		},
+	}
+
+	addFilterFlags(cmd, opts)
+	cmd.Flags().IntVar(&opts.Top, "top", 0, "keep the first N authors and fold the rest into a single "+gitfame.Others+" row")
+	cmd.Flags().StringVar(&timelineOpts.Period, "period", gitfame.PeriodMonth,
+		"length of the buckets of the commits, one of "+strings.Join(gitfame.TimelinePeriods, ", "))
+	cmd.Flags().BoolVar(&sparkline, "sparkline", false, "print a row per author with an ASCII sparkline of the commits instead")
+
+	return cmd
+}
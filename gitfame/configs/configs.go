@@ -0,0 +1,9 @@
+// Package configs embeds the configuration files shipped with gitfame.
+package configs
+
+import _ "embed"
+
+// LanguageExtensions is the built-in language mapping in JSON.
+//
+//go:embed language_extensions.json
+var LanguageExtensions []byte
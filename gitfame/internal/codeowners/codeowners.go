@@ -0,0 +1,241 @@
+// Package codeowners reads CODEOWNERS files assigning owners to repository paths.
+package codeowners
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gitlab.com/slon/shad-go/gitfame/internal/git"
+)
+
+// Locations are the paths CODEOWNERS is looked for at, in the order of precedence.
+var Locations = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// Rule assigns the owners to the paths matching the pattern.
+type Rule struct {
+	// Line is the 1-based line of the rule in the file.
+	Line    int
+	Pattern string
+	// Owners are empty for rules removing the owners of the matching paths.
+	Owners []string
+}
+
+// IsTeam reports whether the owner is a team, e.g. @org/team.
+func IsTeam(owner string) bool {
+	return strings.HasPrefix(owner, "@") && strings.Contains(owner, "/")
+}
+
+// String formats the rule as a line of CODEOWNERS.
+func (r Rule) String() string {
+	return strings.Join(append([]string{r.Pattern}, r.Owners...), " ")
+}
+
+// File is a parsed CODEOWNERS.
+type File struct {
+	// Source describes where the file was loaded from.
+	Source string
+	Rules  []Rule
+}
+
+// Parse decodes the file. Blank lines and comments starting with # are skipped,
+// patterns starting with \# match paths starting with #.
+//
+// Escaped spaces in patterns are not supported.
+func Parse(source string, data []byte) *File {
+	f := &File{Source: source}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = stripComment(line)
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		f.Rules = append(f.Rules, Rule{Line: i + 1, Pattern: fields[0], Owners: fields[1:]})
+	}
+	return f
+}
+
+// stripComment cuts the line at the first # not escaped with a backslash.
+func stripComment(line string) string {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// ReadFile reads the file from the file system.
+func ReadFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(path, data), nil
+}
+
+// Find reads the first file of Locations in the tree of the revision.
+//
+// Find returns nil if there is no file in any of them.
+func Find(ctx context.Context, repo *git.Repository, rev string) (*File, error) {
+	for _, path := range Locations {
+		data, ok, err := repo.ReadFile(ctx, rev, path)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return Parse(rev+":"+path, data), nil
+		}
+	}
+	return nil, nil
+}
+
+// Matcher finds the rules of paths.
+type Matcher []*regexp.Regexp
+
+// Compile builds the matcher of the rules.
+//
+// Patterns are matched as GitHub does: * and ? do not match slashes, ** matches any directories
+// as a whole path segment, a trailing slash matches the files in the subtree of the directory,
+// and patterns with a leading or a middle slash are relative to the root, others match at any depth.
+// Patterns without wildcards in the last segment match the files in the subtree of the directory
+// of the same path too, so /docs/* matches docs/a.md, but not docs/a/b.md. Negations and character
+// ranges are not supported by GitHub and are reported.
+func (f *File) Compile() (Matcher, error) {
+	m := make(Matcher, 0, len(f.Rules))
+	for _, r := range f.Rules {
+		re, err := compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: pattern %q: %w", f.Source, r.Line, r.Pattern, err)
+		}
+		m = append(m, re)
+	}
+	return m, nil
+}
+
+// split returns the pattern without the leading and the trailing slashes,
+// whether it is relative to the root and whether it matches a directory only.
+func split(pattern string) (path string, anchored, dir bool) {
+	dir = strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+	anchored = strings.Contains(pattern, "/")
+	return strings.TrimPrefix(pattern, "/"), anchored, dir
+}
+
+// Normalize returns the same form for the patterns Compile matches the same way:
+// the patterns matching every file are *, and the patterns relative to the root
+// get a leading slash and have the trailing /** replaced with a slash.
+// For example, /dir/, dir/** and /dir/** are /dir/, but dir/ matches at any depth and stays dir/.
+func Normalize(pattern string) string {
+	path, anchored, dir := split(pattern)
+	if !dir && (path == "**" || path == "*" && !anchored) {
+		return "*"
+	}
+	if anchored && strings.HasSuffix(path, "/**") {
+		path, dir = strings.TrimSuffix(path, "/**"), true
+	}
+	if anchored {
+		path = "/" + path
+	}
+	if dir {
+		path += "/"
+	}
+	return path
+}
+
+// compile converts the pattern into a regular expression matching the paths it applies to.
+func compile(pattern string) (*regexp.Regexp, error) {
+	if strings.HasPrefix(pattern, "!") {
+		return nil, errors.New("negations are not supported")
+	}
+
+	pattern, anchored, dir := split(pattern)
+	if pattern == "" {
+		return nil, errors.New("empty pattern")
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	if !anchored {
+		b.WriteString("(?:.*/)?")
+	}
+
+	segments := strings.Split(pattern, "/")
+	wildcard := false
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		if segment == "**" {
+			if last {
+				b.WriteString(".*")
+			} else {
+				b.WriteString("(?:.*/)?")
+			}
+			wildcard = last
+			continue
+		}
+
+		var err error
+		if wildcard, err = writeSegment(&b, segment); err != nil {
+			return nil, err
+		}
+		if !last {
+			b.WriteString("/")
+		}
+	}
+
+	switch {
+	case dir:
+		b.WriteString("/.*")
+	case !wildcard:
+		// The directory of the same path owns its subtree.
+		b.WriteString("(?:/.*)?")
+	}
+	b.WriteString("$")
+
+	return regexp.Compile(b.String())
+}
+
+// writeSegment writes the regular expression of the path segment, wildcard is set if it has any.
+func writeSegment(b *strings.Builder, segment string) (wildcard bool, err error) {
+	for i := 0; i < len(segment); i++ {
+		switch segment[i] {
+		case '*':
+			wildcard = true
+			b.WriteString("[^/]*")
+			for i+1 < len(segment) && segment[i+1] == '*' {
+				i++
+			}
+		case '?':
+			wildcard = true
+			b.WriteString("[^/]")
+		case '[':
+			return false, errors.New("character ranges are not supported")
+		case '\\':
+			if i+1 == len(segment) {
+				return false, errors.New("trailing backslash")
+			}
+			i++
+			b.WriteString(regexp.QuoteMeta(segment[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(segment[i : i+1]))
+		}
+	}
+	return wildcard, nil
+}
+
+// Match returns the index of the last rule matching the slash-separated path, -1 if there is none.
+func (m Matcher) Match(path string) int {
+	for i := len(m) - 1; i >= 0; i-- {
+		if m[i].MatchString(path) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,107 @@
+package codeowners
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	f := Parse("CODEOWNERS", []byte(`# Default owners.
+*       @org/core
+
+/docs/  @alice docs@example.com # the writers
+*.go    @bob
+/vendor/
+\#notes @carol # escaped
+`))
+
+	require.Equal(t, "CODEOWNERS", f.Source)
+	require.Equal(t, []Rule{
+		{Line: 2, Pattern: "*", Owners: []string{"@org/core"}},
+		{Line: 4, Pattern: "/docs/", Owners: []string{"@alice", "docs@example.com"}},
+		{Line: 5, Pattern: "*.go", Owners: []string{"@bob"}},
+		{Line: 6, Pattern: "/vendor/", Owners: []string{}},
+		{Line: 7, Pattern: `\#notes`, Owners: []string{"@carol"}},
+	}, f.Rules)
+
+	require.Equal(t, "/docs/ @alice docs@example.com", f.Rules[1].String())
+	require.Equal(t, "/vendor/", f.Rules[3].String())
+}
+
+func TestMatcher(t *testing.T) {
+	f := Parse("CODEOWNERS", []byte(`*         @core
+*.md      @docs
+/cmp/     @cmp
+/cmp/internal/
+docs/     @docs
+/api/*    @api
+/lib      @lib
+**/gen/** @gen
+\#*       @hash
+`))
+
+	m, err := f.Compile()
+	require.NoError(t, err)
+
+	for path, rule := range map[string]int{
+		"go.mod":                     0,
+		"README.md":                  1,
+		"cmp/compare.go":             2,
+		"cmp/README.md":              2,
+		"cmp/internal/value/sort.go": 3,
+		"x/docs/index.html":          4,
+		"api/v1.go":                  5,
+		// * does not match slashes, so the nested files are owned by the previous rules.
+		"api/v1/types.go":  0,
+		"api/v1/README.md": 1,
+		"lib/a/b.go":       6,
+		"library.go":       0,
+		"x/gen/y/z.go":     7,
+		"gen/z.go":         7,
+		"#notes":           8,
+	} {
+		require.Equal(t, rule, m.Match(path), path)
+	}
+
+	m, err = Parse("CODEOWNERS", []byte("/docs/ @docs\n/docs/* @writers\n")).Compile()
+	require.NoError(t, err)
+	require.Equal(t, -1, m.Match("go.mod"))
+	require.Equal(t, 1, m.Match("docs/a.md"))
+	require.Equal(t, 0, m.Match("docs/a/b.md"))
+
+	_, err = Parse("CODEOWNERS", []byte("[a @x\n")).Compile()
+	require.ErrorContains(t, err, "CODEOWNERS:1:")
+
+	_, err = Parse("CODEOWNERS", []byte("*\n!*.go @x\n")).Compile()
+	require.ErrorContains(t, err, "CODEOWNERS:2:")
+}
+
+func TestIsTeam(t *testing.T) {
+	require.True(t, IsTeam("@org/team"))
+	require.False(t, IsTeam("@user"))
+	require.False(t, IsTeam("user@example.com"))
+}
+
+func TestNormalize(t *testing.T) {
+	for pattern, normalized := range map[string]string{
+		"*":          "*",
+		"**":         "*",
+		"/**":        "*",
+		"/*":         "/*",
+		"dir/":       "dir/",
+		"/dir/":      "/dir/",
+		"dir/**":     "/dir/",
+		"/dir/**":    "/dir/",
+		"dir":        "dir",
+		"/dir":       "/dir",
+		"a/b/":       "/a/b/",
+		"/a/b/":      "/a/b/",
+		"*.go":       "*.go",
+		"docs/*.md":  "/docs/*.md",
+		"**/gen/**":  "/**/gen/",
+		"/**/gen/**": "/**/gen/",
+	} {
+		require.Equal(t, normalized, Normalize(pattern), pattern)
+	}
+}
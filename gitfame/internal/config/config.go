@@ -0,0 +1,190 @@
+// Package config loads .gitfame.yml files holding default flag values.
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+
+	"gitlab.com/slon/shad-go/gitfame/internal/git"
+)
+
+// FileName is the name of the config file.
+const FileName = ".gitfame.yml"
+
+// Config maps flag names to their default values.
+type Config struct {
+	// Source describes where the config was loaded from.
+	Source string
+	// Dir is the directory relative file paths of the config are resolved against.
+	Dir string
+
+	values map[string]interface{}
+}
+
+// Parse decodes the config.
+//
+// The config is a YAML mapping of flag names to scalars or lists of scalars.
+func Parse(source, dir string, data []byte) (*Config, error) {
+	var values map[string]interface{}
+	if err := yaml.UnmarshalStrict(data, &values); err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+
+	return &Config{Source: source, Dir: dir, values: values}, nil
+}
+
+// ReadDir reads the config from the directory.
+//
+// ReadDir returns nil if the directory has no config.
+func ReadDir(dir string) (*Config, error) {
+	path := filepath.Join(dir, FileName)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return Parse(path, dir, data)
+}
+
+// FindInRepository looks for the config in the top-level directory of the repository
+// and then in the tree of the revision.
+//
+// FindInRepository returns nil if there is no config in either of them.
+func FindInRepository(ctx context.Context, repo *git.Repository, rev string) (*Config, error) {
+	dir := repo.Dir()
+	if top, err := repo.Toplevel(ctx); err == nil {
+		dir = top
+		if c, err := ReadDir(top); c != nil || err != nil {
+			return c, err
+		}
+	}
+
+	// Report unknown revisions as such rather than as failures to read the file.
+	if _, err := repo.ResolveRevision(ctx, rev); err != nil {
+		return nil, err
+	}
+
+	data, ok, err := repo.ReadFile(ctx, rev, FileName)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	return Parse(rev+":"+FileName, dir, data)
+}
+
+// Without returns a copy of the config without the keys,
+// e.g. the ones naming flags of other commands.
+func (c *Config) Without(keys ...string) *Config {
+	values := make(map[string]interface{}, len(c.values))
+	for k, v := range c.values {
+		if !slices.Contains(keys, k) {
+			values[k] = v
+		}
+	}
+	return &Config{Source: c.Source, Dir: c.Dir, values: values}
+}
+
+// Apply sets flags missing from the command line to the config values.
+//
+// Keys must name flags of the command, except for the forbidden ones.
+// Relative paths given to flags marked with cobra.Command.MarkFlagFilename
+// are resolved against Dir.
+func (c *Config) Apply(flags *pflag.FlagSet, forbidden ...string) error {
+	for _, name := range forbidden {
+		if _, ok := c.values[name]; ok {
+			return fmt.Errorf("%s: key %q is not allowed in this config", c.Source, name)
+		}
+	}
+
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		f := flags.Lookup(key)
+		if f == nil {
+			return fmt.Errorf("%s: unknown key %q", c.Source, key)
+		}
+
+		if f.Changed {
+			continue
+		}
+
+		values, err := c.strings(key)
+		if err != nil {
+			return err
+		}
+
+		if _, ok := f.Annotations[cobra.BashCompFilenameExt]; ok {
+			for i, v := range values {
+				if v != "" && !filepath.IsAbs(v) {
+					values[i] = filepath.Join(c.Dir, v)
+				}
+			}
+		}
+
+		if err := set(f, values); err != nil {
+			return fmt.Errorf("%s: invalid value for %q: %w", c.Source, key, err)
+		}
+	}
+
+	return nil
+}
+
+// strings converts the value of the key to a list of strings.
+func (c *Config) strings(key string) ([]string, error) {
+	switch v := c.values[key].(type) {
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := scalar(item)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %q: %w", c.Source, key, err)
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	default:
+		s, err := scalar(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q: %w", c.Source, key, err)
+		}
+		return []string{s}, nil
+	}
+}
+
+func scalar(v interface{}) (string, error) {
+	switch v.(type) {
+	case string, bool, int, int64, uint64, float64:
+		return fmt.Sprint(v), nil
+	case nil:
+		return "", nil
+	default:
+		return "", fmt.Errorf("expected a scalar, got %T", v)
+	}
+}
+
+func set(f *pflag.Flag, values []string) error {
+	if slice, ok := f.Value.(pflag.SliceValue); ok {
+		return slice.Replace(values)
+	}
+
+	if len(values) != 1 {
+		return fmt.Errorf("expected a single value, got %d", len(values))
+	}
+	return f.Value.Set(values[0])
+}
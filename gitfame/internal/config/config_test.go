@@ -0,0 +1,101 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func newCommand() *cobra.Command {
+	cmd := &cobra.Command{Use: "gitfame"}
+	cmd.Flags().String("format", "tabular", "")
+	cmd.Flags().StringSlice("extensions", nil, "")
+	cmd.Flags().StringArray("exclude-from", nil, "")
+	cmd.Flags().Bool("use-committer", false, "")
+	cmd.Flags().String("revision", "HEAD", "")
+	_ = cmd.MarkFlagFilename("exclude-from")
+	return cmd
+}
+
+func TestApply(t *testing.T) {
+	cmd := newCommand()
+	require.NoError(t, cmd.Flags().Parse([]string{"--format", "json"}))
+
+	c, err := Parse("test", "/repo", []byte(`
+format: csv
+extensions: [.go, .md]
+exclude-from:
+  - .fameignore
+  - /etc/fameignore
+use-committer: true
+`))
+	require.NoError(t, err)
+	require.NoError(t, c.Apply(cmd.Flags()))
+
+	format, _ := cmd.Flags().GetString("format")
+	require.Equal(t, "json", format, "command line must win")
+
+	extensions, _ := cmd.Flags().GetStringSlice("extensions")
+	require.Equal(t, []string{".go", ".md"}, extensions)
+
+	excludeFrom, _ := cmd.Flags().GetStringArray("exclude-from")
+	require.Equal(t, []string{"/repo/.fameignore", "/etc/fameignore"}, excludeFrom)
+
+	useCommitter, _ := cmd.Flags().GetBool("use-committer")
+	require.True(t, useCommitter)
+}
+
+func TestApplyErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		config    string
+		forbidden []string
+	}{
+		{name: "unknown key", config: "order_by: lines"},
+		{name: "forbidden key", config: "revision: v1.0", forbidden: []string{"revision"}},
+		{name: "list for scalar", config: "format: [csv, json]"},
+		{name: "mapping value", config: "format: {name: csv}"},
+		{name: "bad bool", config: "use-committer: sometimes"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := Parse("test", "", []byte(tc.config))
+			require.NoError(t, err)
+			require.Error(t, c.Apply(newCommand().Flags(), tc.forbidden...))
+		})
+	}
+
+	_, err := Parse("test", "", []byte("- format"))
+	require.Error(t, err)
+}
+
+func TestWithout(t *testing.T) {
+	c, err := Parse("test", "", []byte("format: csv\nmanifest: repos.txt\n"))
+	require.NoError(t, err)
+	require.Error(t, c.Apply(newCommand().Flags()))
+
+	cmd := newCommand()
+	require.NoError(t, c.Without("manifest").Apply(cmd.Flags()))
+	format, _ := cmd.Flags().GetString("format")
+	require.Equal(t, "csv", format)
+
+	require.Error(t, c.Apply(newCommand().Flags()), "the config must not change")
+}
+
+func TestReadDir(t *testing.T) {
+	dir := t.TempDir()
+
+	c, err := ReadDir(dir)
+	require.NoError(t, err)
+	require.Nil(t, c)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, FileName), []byte("format: csv\n"), 0o644))
+
+	c, err = ReadDir(dir)
+	require.NoError(t, err)
+	require.NotNil(t, c)
+	require.Equal(t, dir, c.Dir)
+	require.Equal(t, filepath.Join(dir, FileName), c.Source)
+}
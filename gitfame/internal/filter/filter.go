@@ -0,0 +1,66 @@
+// Package filter selects repository files taking part in the calculation.
+package filter
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Filter decides whether a file is included into the calculation.
+//
+// The zero value includes every file.
+type Filter struct {
+	// Extensions restricts files to the ones with any of the extensions.
+	Extensions []string
+	// Languages restricts files to the ones with any of the language extensions.
+	// Unlike an empty Extensions, an empty non-nil Languages excludes every file.
+	Languages []string
+	// Exclude excludes matching files if set.
+	Exclude Matcher
+	// RestrictTo excludes files it does not match if set.
+	RestrictTo Matcher
+	// Strip is a directory, Exclude and RestrictTo match the paths of its files
+	// relative to it as well as the full ones if set.
+	Strip string
+}
+
+// Match reports whether the file with the given slash-separated path is included.
+func (f *Filter) Match(path string) bool {
+	if len(f.Extensions) > 0 && !hasExtension(path, f.Extensions) {
+		return false
+	}
+
+	if f.Languages != nil && !hasExtension(path, f.Languages) {
+		return false
+	}
+
+	if f.Exclude != nil && f.matches(f.Exclude, path) {
+		return false
+	}
+
+	if f.RestrictTo != nil && !f.matches(f.RestrictTo, path) {
+		return false
+	}
+
+	return true
+}
+
+// matches reports whether m matches the path or its part relative to Strip.
+func (f *Filter) matches(m Matcher, path string) bool {
+	if m.Match(path) {
+		return true
+	}
+
+	rel, ok := strings.CutPrefix(path, f.Strip+"/")
+	return f.Strip != "" && ok && m.Match(rel)
+}
+
+func hasExtension(path string, extensions []string) bool {
+	name := filepath.Base(path)
+	for _, ext := range extensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterStrip(t *testing.T) {
+	exclude, err := Compile(SyntaxGlob, []string{"*_test.go"})
+	require.NoError(t, err)
+	restrictTo, err := Compile(SyntaxGlob, []string{"*.go", "docs/*"})
+	require.NoError(t, err)
+
+	f := &Filter{Exclude: exclude, RestrictTo: restrictTo}
+	for path, match := range map[string]bool{
+		"main.go":        true,
+		"main_test.go":   false,
+		"cmp/compare.go": false,
+		"docs/a.md":      true,
+	} {
+		require.Equal(t, match, f.Match(path), path)
+	}
+
+	f.Strip = "cmp"
+	for path, match := range map[string]bool{
+		// Patterns match the stripped paths...
+		"cmp/compare.go":      true,
+		"cmp/compare_test.go": false,
+		"cmp/docs/a.md":       true,
+		"cmp/internal/x.go":   false,
+		// ...as well as the full ones.
+		"docs/a.md":  true,
+		"main.go":    true,
+		"other/a.go": false,
+	} {
+		require.Equal(t, match, f.Match(path), path)
+	}
+}
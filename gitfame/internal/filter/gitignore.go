@@ -0,0 +1,190 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// gitignorePattern is a single compiled line of a .gitignore file.
+type gitignorePattern struct {
+	re *regexp.Regexp
+	// negate is set for patterns prefixed with !.
+	negate bool
+	// dirOnly is set for patterns with a trailing slash.
+	dirOnly bool
+}
+
+// gitignoreMatcher matches paths the way git matches them against .gitignore:
+// the last matching pattern wins, and a file inside a matched directory
+// matches as well, even if the file itself is matched by a negation.
+type gitignoreMatcher []gitignorePattern
+
+func compileGitignore(patterns []string) (Matcher, error) {
+	var m gitignoreMatcher
+	for _, p := range patterns {
+		compiled, ok, err := compileGitignorePattern(p)
+		if err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %w", p, err)
+		}
+		if ok {
+			m = append(m, compiled)
+		}
+	}
+
+	if len(m) == 0 {
+		return nil, nil
+	}
+
+	return m, nil
+}
+
+// compileGitignorePattern compiles a single pattern.
+// Blank patterns and comments are reported with ok set to false.
+func compileGitignorePattern(p string) (pattern gitignorePattern, ok bool, err error) {
+	p = trimTrailingSpaces(p)
+	if p == "" || strings.HasPrefix(p, "#") {
+		return pattern, false, nil
+	}
+
+	switch {
+	case strings.HasPrefix(p, "!"):
+		pattern.negate = true
+		p = p[1:]
+	case strings.HasPrefix(p, `\!`), strings.HasPrefix(p, `\#`):
+		p = p[1:]
+	}
+
+	if strings.HasSuffix(p, "/") {
+		pattern.dirOnly = true
+		p = strings.TrimRight(p, "/")
+	}
+
+	// A slash at the beginning or in the middle anchors the pattern to the repository root,
+	// otherwise the pattern matches at any level.
+	if strings.Contains(p, "/") {
+		p = strings.TrimPrefix(p, "/")
+	} else {
+		p = "**/" + p
+	}
+
+	if p == "" || p == "**/" {
+		return pattern, false, nil
+	}
+
+	expr, err := translateGitignore(p)
+	if err != nil {
+		return pattern, false, err
+	}
+
+	pattern.re, err = regexp.Compile(expr)
+	if err != nil {
+		return pattern, false, err
+	}
+
+	return pattern, true, nil
+}
+
+// trimTrailingSpaces removes trailing spaces unless they are escaped with a backslash.
+func trimTrailingSpaces(p string) string {
+	for strings.HasSuffix(p, " ") && !strings.HasSuffix(p, `\ `) {
+		p = p[:len(p)-1]
+	}
+	return p
+}
+
+// translateGitignore converts an anchored gitignore pattern into a regular expression.
+func translateGitignore(p string) (string, error) {
+	var b strings.Builder
+	b.WriteString("^")
+
+	for i := 0; i < len(p); {
+		atSegmentStart := i == 0 || p[i-1] == '/'
+
+		switch {
+		case atSegmentStart && strings.HasPrefix(p[i:], "**/"):
+			// Leading and inner **/ match zero or more directories.
+			b.WriteString("(?:.*/)?")
+			i += 3
+		case atSegmentStart && p[i:] == "**":
+			// Trailing /** matches everything inside.
+			b.WriteString(".*")
+			i += 2
+		case p[i] == '*':
+			b.WriteString("[^/]*")
+			i++
+		case p[i] == '?':
+			b.WriteString("[^/]")
+			i++
+		case p[i] == '[':
+			class, n, err := translateClass(p[i:])
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(class)
+			i += n
+		case p[i] == '\\':
+			if i+1 == len(p) {
+				return "", fmt.Errorf("trailing backslash")
+			}
+			b.WriteString(regexp.QuoteMeta(p[i+1 : i+2]))
+			i += 2
+		default:
+			b.WriteString(regexp.QuoteMeta(p[i : i+1]))
+			i++
+		}
+	}
+
+	b.WriteString("$")
+	return b.String(), nil
+}
+
+// translateClass converts a bracket expression at the beginning of p
+// and returns it along with the number of consumed bytes.
+func translateClass(p string) (string, int, error) {
+	var b strings.Builder
+	b.WriteString("[")
+
+	i := 1
+	if i < len(p) && (p[i] == '!' || p[i] == '^') {
+		b.WriteString("^/")
+		i++
+	}
+
+	for start := i; i < len(p); i++ {
+		switch c := p[i]; {
+		case c == ']' && i > start:
+			b.WriteString("]")
+			return b.String(), i + 1, nil
+		case c == '\\' && i+1 < len(p):
+			i++
+			b.WriteString(regexp.QuoteMeta(p[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(p[i : i+1]))
+		}
+	}
+
+	return "", 0, fmt.Errorf("unterminated character class")
+}
+
+func (m gitignoreMatcher) Match(path string) bool {
+	for i := 0; i < len(path); i++ {
+		if path[i] == '/' && m.match(path[:i], true) {
+			return true
+		}
+	}
+	return m.match(path, false)
+}
+
+func (m gitignoreMatcher) match(path string, isDir bool) bool {
+	matched := false
+	for _, p := range m {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if p.re.MatchString(path) {
+			matched = !p.negate
+		}
+	}
+	return matched
+}
@@ -0,0 +1,129 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGitignoreMatcher(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		patterns []string
+		match    []string
+		noMatch  []string
+	}{
+		{
+			name:     "unanchored name",
+			patterns: []string{"*.go"},
+			match:    []string{"main.go", "cmd/gitfame/main.go"},
+			noMatch:  []string{"main.go.orig", "go.mod"},
+		},
+		{
+			name:     "anchored",
+			patterns: []string{"/vendor"},
+			match:    []string{"vendor", "vendor/a.go", "vendor/a/b.go"},
+			noMatch:  []string{"pkg/vendor/a.go", "vendors/a.go"},
+		},
+		{
+			name:     "middle slash anchors",
+			patterns: []string{"cmp/internal"},
+			match:    []string{"cmp/internal/value/sort.go"},
+			noMatch:  []string{"x/cmp/internal/value/sort.go"},
+		},
+		{
+			name:     "directory only",
+			patterns: []string{"testdata/"},
+			match:    []string{"testdata/a.txt", "cmp/testdata/diffs"},
+			noMatch:  []string{"testdata", "cmp/testdata.go"},
+		},
+		{
+			name:     "leading double star",
+			patterns: []string{"**/internal/*.go"},
+			match:    []string{"internal/a.go", "cmp/internal/a.go"},
+			noMatch:  []string{"cmp/internal/value/a.go"},
+		},
+		{
+			name:     "inner double star",
+			patterns: []string{"cmp/**/sort.go"},
+			match:    []string{"cmp/sort.go", "cmp/internal/value/sort.go"},
+			noMatch:  []string{"sort.go", "x/cmp/sort.go"},
+		},
+		{
+			name:     "trailing double star",
+			patterns: []string{"cmp/**"},
+			match:    []string{"cmp/a.go", "cmp/internal/value/sort.go"},
+			noMatch:  []string{"cmp", "cmpopts/a.go"},
+		},
+		{
+			name:     "negation",
+			patterns: []string{"*.go", "!*_test.go"},
+			match:    []string{"a.go", "pkg/a.go"},
+			noMatch:  []string{"a_test.go", "pkg/a_test.go", "README.md"},
+		},
+		{
+			name:     "negation can not re-include files of an excluded directory",
+			patterns: []string{"vendor/", "!vendor/keep.go"},
+			match:    []string{"vendor/keep.go", "vendor/a.go"},
+		},
+		{
+			name:     "last match wins",
+			patterns: []string{"!a.go", "a.go"},
+			match:    []string{"a.go"},
+		},
+		{
+			name:     "character class",
+			patterns: []string{"file[0-9].txt", "[!a-z]*.md"},
+			match:    []string{"file1.txt", "DOC.md"},
+			noMatch:  []string{"filex.txt", "doc.md"},
+		},
+		{
+			name:     "escapes",
+			patterns: []string{`\!important`, `\#hash`, `star\*`, `space\ `},
+			match:    []string{"!important", "#hash", "star*", "space "},
+			noMatch:  []string{"important", "stars", "space"},
+		},
+		{
+			name:     "comments and blank lines",
+			patterns: []string{"# comment", "", "   ", "a.go   "},
+			match:    []string{"a.go"},
+			noMatch:  []string{"# comment"},
+		},
+		{
+			name:     "spaces in names",
+			patterns: []string{"my file.md"},
+			match:    []string{"my file.md", "docs/my file.md"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := Compile(SyntaxGitignore, tc.patterns)
+			require.NoError(t, err)
+			require.NotNil(t, m)
+
+			for _, path := range tc.match {
+				require.True(t, m.Match(path), "expected %q to match", path)
+			}
+			for _, path := range tc.noMatch {
+				require.False(t, m.Match(path), "expected %q not to match", path)
+			}
+		})
+	}
+}
+
+func TestGitignoreBadPatterns(t *testing.T) {
+	for _, p := range []string{"[abc", `trailing\`} {
+		_, err := Compile(SyntaxGitignore, []string{p})
+		require.Error(t, err, p)
+	}
+}
+
+func TestCompileEmpty(t *testing.T) {
+	for _, syntax := range Syntaxes {
+		m, err := Compile(syntax, nil)
+		require.NoError(t, err)
+		require.Nil(t, m)
+	}
+
+	_, err := Compile("regexp", []string{"a"})
+	require.Error(t, err)
+}
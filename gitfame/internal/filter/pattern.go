@@ -0,0 +1,92 @@
+package filter
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Pattern syntaxes.
+const (
+	// SyntaxGlob matches whole paths with path/filepath.Match.
+	SyntaxGlob = "glob"
+	// SyntaxGitignore matches paths the way .gitignore files do.
+	SyntaxGitignore = "gitignore"
+)
+
+// Syntaxes lists all supported pattern syntaxes.
+var Syntaxes = []string{SyntaxGlob, SyntaxGitignore}
+
+// Matcher matches slash-separated file paths against a set of patterns.
+type Matcher interface {
+	Match(path string) bool
+}
+
+// Compile builds a matcher out of patterns of the given syntax.
+//
+// Compile returns nil if there are no patterns.
+func Compile(syntax string, patterns []string) (Matcher, error) {
+	switch syntax {
+	case SyntaxGlob:
+		return compileGlob(patterns)
+	case SyntaxGitignore:
+		return compileGitignore(patterns)
+	default:
+		return nil, fmt.Errorf("unknown pattern syntax %q", syntax)
+	}
+}
+
+// ReadPatterns reads patterns from a file, one per line.
+//
+// Blank lines and lines starting with # are skipped.
+func ReadPatterns(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var patterns []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSuffix(s.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return patterns, nil
+}
+
+// globMatcher matches paths against any of path/filepath.Match patterns.
+type globMatcher []string
+
+func compileGlob(patterns []string) (Matcher, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+
+	for _, p := range patterns {
+		if _, err := filepath.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %w", p, err)
+		}
+	}
+
+	return globMatcher(patterns), nil
+}
+
+func (m globMatcher) Match(path string) bool {
+	for _, p := range m {
+		if ok, _ := filepath.Match(p, path); ok {
+			return true
+		}
+	}
+	return false
+}
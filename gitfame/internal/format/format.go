@@ -0,0 +1,118 @@
+// Package format renders gitfame reports in the supported output formats.
+package format
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Output formats.
+const (
+	Tabular   = "tabular"
+	CSV       = "csv"
+	JSON      = "json"
+	JSONLines = "json-lines"
+)
+
+// Formats lists all supported output formats.
+var Formats = []string{Tabular, CSV, JSON, JSONLines}
+
+// Validate checks that the format is supported.
+func Validate(format string) error {
+	for _, f := range Formats {
+		if f == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+// Table is a report rendered the same way by every output format:
+// tabular and csv print the records, json and json-lines encode the items.
+type Table[T any] struct {
+	Header []string
+	Items  []T
+	// Record converts an item into a row of the Header columns.
+	Record func(item *T) []string
+
+	// Metadata is written by json formats if set: json writes an object
+	// with the metadata and the items under the Key field, json-lines writes
+	// an object with the metadata field before the items.
+	Metadata any
+	Key      string
+}
+
+// Write renders the table to w in the given format.
+func (t *Table[T]) Write(w io.Writer, format string) error {
+	switch format {
+	case Tabular:
+		return writeTabular(w, t.records())
+	case CSV:
+		return writeCSV(w, t.records())
+	case JSON:
+		if t.Metadata != nil {
+			return t.writeJSONObject(w)
+		}
+		return writeJSON(w, t.Items)
+	case JSONLines:
+		if t.Metadata != nil {
+			if err := json.NewEncoder(w).Encode(map[string]any{"metadata": t.Metadata}); err != nil {
+				return err
+			}
+		}
+		return writeJSONLines(w, t.Items)
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
+
+func (t *Table[T]) writeJSONObject(w io.Writer) error {
+	items := t.Items
+	if items == nil {
+		items = []T{}
+	}
+	return json.NewEncoder(w).Encode(map[string]any{"metadata": t.Metadata, t.Key: items})
+}
+
+func (t *Table[T]) records() [][]string {
+	records := [][]string{t.Header}
+	for i := range t.Items {
+		records = append(records, t.Record(&t.Items[i]))
+	}
+	return records
+}
+
+func writeTabular(w io.Writer, records [][]string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	for _, r := range records {
+		if _, err := fmt.Fprintln(tw, strings.Join(r, "\t")); err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
+
+func writeCSV(w io.Writer, records [][]string) error {
+	return csv.NewWriter(w).WriteAll(records)
+}
+
+func writeJSON[T any](w io.Writer, items []T) error {
+	if items == nil {
+		items = []T{}
+	}
+	return json.NewEncoder(w).Encode(items)
+}
+
+func writeJSONLines[T any](w io.Writer, items []T) error {
+	enc := json.NewEncoder(w)
+	for i := range items {
+		if err := enc.Encode(&items[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package format
+
+import (
+	"io"
+	"strings"
+
+	"gitlab.com/slon/shad-go/gitfame/internal/languages"
+)
+
+// WriteLanguages renders the language mapping to w in the given format.
+//
+// The json format produces a valid --languages-config file.
+func WriteLanguages(w io.Writer, format string, langs []languages.Language) error {
+	t := &Table[languages.Language]{
+		Header: []string{"Name", "Type", "Extensions"},
+		Items:  langs,
+		Record: func(l *languages.Language) []string {
+			return []string{l.Name, l.Type, strings.Join(l.Extensions, ",")}
+		},
+	}
+	return t.Write(w, format)
+}
@@ -0,0 +1,83 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Attribute values reported by Attributes besides the assigned ones.
+const (
+	AttributeSet         = "set"
+	AttributeUnset       = "unset"
+	AttributeUnspecified = "unspecified"
+)
+
+// Attributes returns the value of the gitattributes attribute of each path
+// as defined by the .gitattributes files in the tree of the given revision.
+//
+// The tree is read into a temporary index, the index of the repository is not touched.
+func (r *Repository) Attributes(ctx context.Context, rev, attr string, paths []string) (map[string]string, error) {
+	if len(paths) == 0 {
+		return map[string]string{}, nil
+	}
+
+	dir, err := os.MkdirTemp("", "gitfame-index-")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	index := "GIT_INDEX_FILE=" + filepath.Join(dir, "index")
+
+	readTree := r.command(ctx, "read-tree", rev)
+	readTree.Env = append(os.Environ(), index)
+	var stderr bytes.Buffer
+	readTree.Stderr = &stderr
+	if err := readTree.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("git read-tree: %w", ctx.Err())
+		}
+		return nil, &Error{Args: readTree.Args[1:], Err: err, Stderr: strings.TrimSpace(stderr.String())}
+	}
+
+	checkAttr := r.command(ctx, "check-attr", "--cached", "-z", "--stdin", attr)
+	checkAttr.Env = append(os.Environ(), index)
+	checkAttr.Stdin = strings.NewReader(strings.Join(paths, "\x00") + "\x00")
+	stderr.Reset()
+	checkAttr.Stderr = &stderr
+	out, err := checkAttr.Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("git check-attr: %w", ctx.Err())
+		}
+		return nil, &Error{Args: checkAttr.Args[1:], Err: err, Stderr: strings.TrimSpace(stderr.String())}
+	}
+
+	// <path> NUL <attribute> NUL <value> NUL
+	fields := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	if len(out) == 0 {
+		fields = nil
+	}
+	if len(fields)%3 != 0 {
+		return nil, fmt.Errorf("git check-attr: malformed output %q", out)
+	}
+
+	values := make(map[string]string, len(paths))
+	for i := 0; i < len(fields); i += 3 {
+		values[fields[i]] = fields[i+2]
+	}
+	return values, nil
+}
+
+// BinarySniffSize is the number of the first bytes IsBinary looks at.
+const BinarySniffSize = 8000
+
+// IsBinary reports whether the contents look binary, as git does:
+// a NUL byte among the first BinarySniffSize bytes.
+func IsBinary(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), BinarySniffSize)], 0) >= 0
+}
@@ -0,0 +1,27 @@
+package git
+
+import "context"
+
+// Backend reads the history of a repository needed to blame a revision.
+//
+// Repository implements it with the git command and GoGit with the go-git
+// library. Recorder and Replay capture and serve the responses of another backend.
+//
+// Backend must be safe for concurrent use.
+type Backend interface {
+	// ResolveRevision returns hash of the commit the revision points to,
+	// ErrUnknownRevision if there is no such commit.
+	ResolveRevision(ctx context.Context, rev string) (string, error)
+	// ListTree returns all files in the tree of the revision,
+	// limited to the subtrees of the paths if any are given.
+	ListTree(ctx context.Context, rev string, paths ...string) ([]File, error)
+	// Blame calls fn for every line of the file at the revision with the commit that last modified it.
+	// Changes of the ignoreRevs commits are attributed to the commits that previously modified the lines.
+	Blame(ctx context.Context, rev, path string, fn LineFunc, ignoreRevs ...string) error
+	// LastCommit returns the last commit that modified the file at the revision.
+	LastCommit(ctx context.Context, rev, path string) (*Commit, error)
+	// ReadCommit returns the commit with the hash.
+	ReadCommit(ctx context.Context, hash string) (*Commit, error)
+}
+
+var _ Backend = (*Repository)(nil)
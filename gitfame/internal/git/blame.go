@@ -0,0 +1,238 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/slon/shad-go/gitfame/internal/porcelain"
+)
+
+// Commit holds the commit metadata reported by git blame.
+type Commit struct {
+	Hash          string    `json:"hash"`
+	Author        string    `json:"author"`
+	AuthorMail    string    `json:"author_mail"`
+	AuthorTime    time.Time `json:"author_time"`
+	Committer     string    `json:"committer"`
+	CommitterMail string    `json:"committer_mail"`
+	CommitterTime time.Time `json:"committer_time"`
+	Summary       string    `json:"summary"`
+}
+
+// LineFunc is called by Blame for every line of the blamed file in order,
+// with the last commit that modified the line. The text is not retained.
+// Blame stops with the error LineFunc returns.
+type LineFunc func(commit *Commit, text string) error
+
+// Blame calls fn for every line of the file at the given revision
+// with the commit that last modified it, as the output of git blame is read.
+//
+// Changes of the ignoreRevs commits are attributed to the commits that
+// previously modified the lines, as with git blame --ignore-rev.
+func (r *Repository) Blame(ctx context.Context, rev, path string, fn LineFunc, ignoreRevs ...string) error {
+	args := []string{"blame", "--porcelain"}
+	for _, ignored := range ignoreRevs {
+		args = append(args, "--ignore-rev", ignored)
+	}
+	args = append(args, rev, "--", path)
+
+	return r.stream(ctx, args, func(out io.Reader) error {
+		if err := readPorcelain(out, fn); err != nil {
+			return fmt.Errorf("git blame %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// LastCommit returns the last commit that modified the file at the given revision.
+//
+// Blame reports nothing for empty files, so they are attributed with LastCommit.
+func (r *Repository) LastCommit(ctx context.Context, rev, path string) (*Commit, error) {
+	return r.logCommit(ctx, rev, "--", path)
+}
+
+// ReadCommit returns the commit with the hash.
+func (r *Repository) ReadCommit(ctx context.Context, hash string) (*Commit, error) {
+	return r.logCommit(ctx, hash)
+}
+
+// FileHistory returns hashes of the commits that modified the file, starting from the given revision.
+func (r *Repository) FileHistory(ctx context.Context, rev, path string) ([]string, error) {
+	out, err := r.output(ctx, "rev-list", rev, "--", path)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// FirstParents returns the commits of the first-parent history of the revision, newest first.
+//
+// Only hashes and committer times of the commits are set.
+func (r *Repository) FirstParents(ctx context.Context, rev string) ([]*Commit, error) {
+	out, err := r.output(ctx, "log", "--first-parent", "--format=%H %ct", rev, "--")
+	if err != nil {
+		return nil, err
+	}
+
+	var commits []*Commit
+	for _, line := range strings.Split(strings.TrimSuffix(string(out), "\n"), "\n") {
+		hash, ct, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("git log: malformed line %q", line)
+		}
+
+		t, err := parseUnixTime(ct)
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, &Commit{Hash: hash, CommitterTime: t})
+	}
+	return commits, nil
+}
+
+// logCommit returns the first commit listed by git log with the arguments.
+func (r *Repository) logCommit(ctx context.Context, args ...string) (*Commit, error) {
+	const format = "%H%x00%aN%x00%aE%x00%at%x00%cN%x00%cE%x00%ct%x00%s"
+
+	out, err := r.output(ctx, append([]string{"log", "-1", "--format=" + format}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := strings.Split(strings.TrimSuffix(string(out), "\n"), "\x00")
+	if len(fields) != 8 {
+		return nil, fmt.Errorf("git log %s: unexpected output %q", strings.Join(args, " "), out)
+	}
+
+	authorTime, err := parseUnixTime(fields[3])
+	if err != nil {
+		return nil, err
+	}
+
+	committerTime, err := parseUnixTime(fields[6])
+	if err != nil {
+		return nil, err
+	}
+
+	return &Commit{
+		Hash:          fields[0],
+		Author:        fields[1],
+		AuthorMail:    fields[2],
+		AuthorTime:    authorTime,
+		Committer:     fields[4],
+		CommitterMail: fields[5],
+		CommitterTime: committerTime,
+		Summary:       fields[7],
+	}, nil
+}
+
+// readPorcelain reads the output of git blame --porcelain calling fn for every line.
+//
+// Only a single group of lines is kept in memory at a time.
+func readPorcelain(out io.Reader, fn LineFunc) error {
+	commits := make(map[*porcelain.Commit]*Commit)
+
+	p := porcelain.NewParser(out)
+	for {
+		g, err := p.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		c, ok := commits[g.Commit]
+		if !ok {
+			c = &Commit{
+				Hash:          g.Commit.Hash,
+				Author:        g.Commit.Author,
+				AuthorMail:    g.Commit.AuthorMail,
+				AuthorTime:    g.Commit.AuthorTime,
+				Committer:     g.Commit.Committer,
+				CommitterMail: g.Commit.CommitterMail,
+				CommitterTime: g.Commit.CommitterTime,
+				Summary:       g.Commit.Summary,
+			}
+			commits[g.Commit] = c
+		}
+
+		for _, text := range g.Lines {
+			if err := fn(c, text); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func parseUnixTime(s string) (time.Time, error) {
+	sec, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("malformed timestamp %q", s)
+	}
+	return time.Unix(sec, 0).UTC(), nil
+}
+
+// LogEntry is a commit with the files it modified.
+type LogEntry struct {
+	Commit *Commit
+	Files  []string
+}
+
+// Log returns non-merge commits reachable from the revision
+// with the files they modified, limited to the paths if any are given.
+//
+// Only hashes, names, emails and times of the authors and the committers of the commits are set.
+func (r *Repository) Log(ctx context.Context, rev string, paths ...string) ([]LogEntry, error) {
+	args := []string{"log", "--no-merges", "-z", "--no-renames", "--name-only",
+		"--format=%x1e%H%x00%aN%x00%aE%x00%at%x00%cN%x00%cE%x00%ct", rev, "--"}
+	out, err := r.output(ctx, append(args, paths...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []LogEntry
+	for _, record := range strings.Split(string(out), "\x1e") {
+		if record == "" {
+			continue
+		}
+
+		// <hash> NUL <author> NUL <author mail> NUL <author time> NUL <committer> NUL <committer mail> NUL <committer time> NUL
+		// LF <file> NUL <file> NUL...
+		fields := strings.Split(record, "\x00")
+		if len(fields) < 7 {
+			return nil, fmt.Errorf("git log: malformed record %q", record)
+		}
+
+		authorTime, err := parseUnixTime(fields[3])
+		if err != nil {
+			return nil, err
+		}
+		committerTime, err := parseUnixTime(fields[6])
+		if err != nil {
+			return nil, err
+		}
+
+		e := LogEntry{Commit: &Commit{
+			Hash:          fields[0],
+			Author:        fields[1],
+			AuthorMail:    fields[2],
+			AuthorTime:    authorTime,
+			Committer:     fields[4],
+			CommitterMail: fields[5],
+			CommitterTime: committerTime,
+		}}
+		for _, path := range fields[7:] {
+			if path = strings.TrimPrefix(path, "\n"); path != "" {
+				e.Files = append(e.Files, path)
+			}
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,160 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ObjectReader reads objects of the repository through a single
+// git cat-file --batch process.
+//
+// ObjectReader is safe for concurrent use.
+type ObjectReader struct {
+	repo *Repository
+	ctx  context.Context
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	stderr bytes.Buffer
+}
+
+// NewObjectReader returns ObjectReader of the repository.
+// The process is started on the first read and killed once ctx is done.
+func (r *Repository) NewObjectReader(ctx context.Context) *ObjectReader {
+	return &ObjectReader{repo: r, ctx: ctx}
+}
+
+func (o *ObjectReader) start() error {
+	cmd := o.repo.command(o.ctx, "cat-file", "--batch")
+	cmd.Stderr = &o.stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return &Error{Args: cmd.Args[1:], Err: err}
+	}
+
+	o.cmd, o.stdin, o.stdout = cmd, stdin, bufio.NewReader(stdout)
+	return nil
+}
+
+// Read returns the type and the contents of the object.
+func (o *ObjectReader) Read(object string) (typ string, data []byte, err error) {
+	return o.read(object, -1)
+}
+
+// ReadPrefix returns the type and at most the first n bytes of the contents of the object.
+// The rest of the contents is discarded without being kept in memory.
+func (o *ObjectReader) ReadPrefix(object string, n int) (typ string, data []byte, err error) {
+	return o.read(object, n)
+}
+
+// read returns the type and at most limit bytes of the contents of the object, all of them if limit is negative.
+func (o *ObjectReader) read(object string, limit int) (typ string, data []byte, err error) {
+	if strings.ContainsAny(object, "\n") {
+		return "", nil, fmt.Errorf("git cat-file: malformed object name %q", object)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.cmd == nil {
+		if err := o.start(); err != nil {
+			return "", nil, err
+		}
+	}
+
+	if _, err := io.WriteString(o.stdin, object+"\n"); err != nil {
+		return "", nil, o.failed(err)
+	}
+
+	// <oid> SP <type> SP <size> LF <contents> LF, or <object> SP missing LF.
+	header, err := o.stdout.ReadString('\n')
+	if err != nil {
+		return "", nil, o.failed(err)
+	}
+
+	fields := strings.Fields(header)
+	if len(fields) == 2 && fields[1] == "missing" {
+		return "", nil, fmt.Errorf("git cat-file: object %s is missing", object)
+	}
+	if len(fields) != 3 {
+		return "", nil, fmt.Errorf("git cat-file: malformed header %q", header)
+	}
+
+	size, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return "", nil, fmt.Errorf("git cat-file: malformed header %q", header)
+	}
+
+	n := size
+	if limit >= 0 && limit < size {
+		n = limit
+	}
+
+	data = make([]byte, n)
+	if _, err := io.ReadFull(o.stdout, data); err != nil {
+		return "", nil, o.failed(err)
+	}
+	// The rest of the contents and the trailing LF.
+	if _, err := o.stdout.Discard(size - n + 1); err != nil {
+		return "", nil, o.failed(err)
+	}
+
+	return fields[1], data, nil
+}
+
+// failed reports a failure of the process and stops it.
+func (o *ObjectReader) failed(err error) error {
+	_ = o.stdin.Close()
+	_ = o.cmd.Wait()
+	o.cmd = nil
+
+	if o.ctx.Err() != nil {
+		return fmt.Errorf("git cat-file: %w", o.ctx.Err())
+	}
+	return &Error{Args: []string{"cat-file", "--batch"}, Err: err, Stderr: strings.TrimSpace(o.stderr.String())}
+}
+
+// Close stops the process.
+func (o *ObjectReader) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.cmd == nil {
+		return nil
+	}
+
+	_ = o.stdin.Close()
+	err := o.cmd.Wait()
+	o.cmd = nil
+	return err
+}
+
+// CommitMessage returns the message of the commit object.
+func CommitMessage(data []byte) (string, error) {
+	// Headers are separated from the message by an empty line.
+	_, message, ok := bytes.Cut(data, []byte("\n\n"))
+	if !ok {
+		if bytes.HasSuffix(data, []byte("\n")) {
+			return "", nil
+		}
+		return "", fmt.Errorf("malformed commit object")
+	}
+	return string(message), nil
+}
@@ -0,0 +1,295 @@
+// Package git wraps the git command line invocations used by gitfame.
+//
+// All commands are read-only: gitfame must never change the state of the
+// repository it analyzes.
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrUnknownRevision is returned when a revision can not be resolved to a commit.
+	ErrUnknownRevision = errors.New("unknown revision")
+	// ErrRepositoryNotFound is returned when the directory does not exist or is not a git repository.
+	ErrRepositoryNotFound = errors.New("repository not found")
+)
+
+// Error is a failure of a git command.
+type Error struct {
+	// Args are the arguments of the command.
+	Args []string
+	// Err is the error of the command execution, usually *exec.ExitError.
+	Err error
+	// Stderr is the trimmed error output of the command.
+	Stderr string
+}
+
+func (e *Error) Error() string {
+	if e.Stderr == "" {
+		return fmt.Sprintf("git %s: %v", e.Args[0], e.Err)
+	}
+	return fmt.Sprintf("git %s: %v: %s", e.Args[0], e.Err, e.Stderr)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Repository is a git repository located in a local directory.
+type Repository struct {
+	dir string
+	// config are the -c options of every command.
+	config []string
+}
+
+// Open returns Repository located in dir.
+func Open(dir string) *Repository {
+	return &Repository{dir: dir}
+}
+
+// WithMailmap returns the repository with names mapped by the mailmap file
+// on top of the .mailmap of the repository, see the mailmap.file option of git.
+//
+// A relative path is relative to the directory of the repository.
+func (r *Repository) WithMailmap(path string) *Repository {
+	return &Repository{dir: r.dir, config: append(slices.Clip(r.config), "-c", "mailmap.file="+path)}
+}
+
+// Dir returns the directory the repository is located in.
+func (r *Repository) Dir() string {
+	return r.dir
+}
+
+// command returns git with the given arguments, killed once ctx is done.
+func (r *Repository) command(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "git", append(slices.Clip(r.config), args...)...)
+	cmd.Dir = r.dir
+	return cmd
+}
+
+// output runs git with given arguments and returns its stdout.
+//
+// Failures are reported as *Error, ErrRepositoryNotFound if the
+// repository directory is missing or is not a git repository,
+// or the error of ctx if it is done.
+func (r *Repository) output(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := r.command(ctx, args...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, r.failed(ctx, args, err, &stderr)
+	}
+
+	return out, nil
+}
+
+// stream runs git with given arguments and passes its stdout to read.
+//
+// If read fails, git is killed and the error of read is returned,
+// other failures are reported as by output.
+func (r *Repository) stream(ctx context.Context, args []string, read func(io.Reader) error) error {
+	cmd := r.command(ctx, args...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return r.failed(ctx, args, err, &stderr)
+	}
+
+	if err := read(stdout); err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		if ctx.Err() != nil {
+			return fmt.Errorf("git %s: %w", args[0], ctx.Err())
+		}
+		return err
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return r.failed(ctx, args, err, &stderr)
+	}
+	return nil
+}
+
+// failed converts the failure of the command with the arguments to the error reported by output.
+func (r *Repository) failed(ctx context.Context, args []string, err error, stderr *bytes.Buffer) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("git %s: %w", args[0], ctx.Err())
+	}
+
+	gitErr := &Error{Args: args, Err: err, Stderr: strings.TrimSpace(stderr.String())}
+
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) && pathErr.Op == "chdir" ||
+		strings.Contains(gitErr.Stderr, "not a git repository") {
+		return fmt.Errorf("%w: %s: %w", ErrRepositoryNotFound, r.dir, gitErr)
+	}
+	return gitErr
+}
+
+// ResolveRevision returns hash of the commit the revision points to.
+func (r *Repository) ResolveRevision(ctx context.Context, rev string) (string, error) {
+	out, err := r.output(ctx, "rev-parse", "--verify", "--quiet", "--end-of-options", rev+"^{commit}")
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && !errors.Is(err, ErrRepositoryNotFound) {
+			return "", fmt.Errorf("%w: %s", ErrUnknownRevision, rev)
+		}
+		return "", err
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// File is a file in the tree of a revision.
+type File struct {
+	Path string `json:"path"`
+	// Object is the hash of the blob.
+	Object string `json:"object"`
+	// Size is the size of the blob in bytes.
+	Size int64 `json:"size"`
+}
+
+// ListFiles returns paths of all files in the tree of the given revision.
+//
+// Submodules and other non-blob entries are skipped.
+func (r *Repository) ListFiles(ctx context.Context, rev string) ([]string, error) {
+	files, err := r.ListTree(ctx, rev)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(files))
+	for _, f := range files {
+		paths = append(paths, f.Path)
+	}
+	return paths, nil
+}
+
+// ListTree returns all files in the tree of the given revision,
+// limited to the subtrees of the paths if any are given.
+//
+// Submodules and other non-blob entries are skipped.
+func (r *Repository) ListTree(ctx context.Context, rev string, paths ...string) ([]File, error) {
+	args := []string{"ls-tree", "-r", "-z", "-l", "--full-tree", rev}
+	if len(paths) > 0 {
+		args = append(append(args, "--"), paths...)
+	}
+
+	out, err := r.output(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []File
+	for _, entry := range bytes.Split(out, []byte{0}) {
+		if len(entry) == 0 {
+			continue
+		}
+
+		// <mode> SP <type> SP <object> SP+ <size> TAB <file>
+		meta, path, ok := bytes.Cut(entry, []byte{'\t'})
+		if !ok {
+			return nil, fmt.Errorf("git ls-tree: malformed entry %q", entry)
+		}
+
+		fields := bytes.Fields(meta)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("git ls-tree: malformed entry %q", entry)
+		}
+
+		if string(fields[1]) != "blob" {
+			continue
+		}
+
+		size, err := strconv.ParseInt(string(fields[3]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("git ls-tree: malformed entry %q", entry)
+		}
+
+		files = append(files, File{Path: string(path), Object: string(fields[2]), Size: size})
+	}
+
+	return files, nil
+}
+
+// Toplevel returns the absolute path of the top-level directory of the working tree.
+func (r *Repository) Toplevel(ctx context.Context) (string, error) {
+	out, err := r.output(ctx, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// ReadFile returns contents of the file in the tree of the given revision.
+//
+// ok is false if there is no such file.
+func (r *Repository) ReadFile(ctx context.Context, rev, path string) (data []byte, ok bool, err error) {
+	out, err := r.output(ctx, "ls-tree", "-z", "--full-tree", rev, "--", path)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(out) == 0 {
+		return nil, false, nil
+	}
+
+	data, err = r.output(ctx, "cat-file", "blob", rev+":"+path)
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// IsAncestor reports whether the commit ancestor is reachable from the commit rev.
+func (r *Repository) IsAncestor(ctx context.Context, ancestor, rev string) (bool, error) {
+	_, err := r.output(ctx, "merge-base", "--is-ancestor", ancestor, rev)
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// ChangedFiles returns paths of the files modified by any commit reachable
+// from to but not from from, merges included.
+//
+// Unlike the diff of the two trees, it reports the files that were changed
+// and then restored, since their lines are attributed to the new commits.
+func (r *Repository) ChangedFiles(ctx context.Context, from, to string) ([]string, error) {
+	out, err := r.output(ctx, "log", "-m", "-z", "--no-renames", "--name-only", "--format=", from+".."+to)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, path := range bytes.Split(out, []byte{0}) {
+		// Entries of different commits are separated by newlines.
+		path = bytes.TrimLeft(path, "\n")
+		if len(path) != 0 {
+			files = append(files, string(path))
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,235 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	gogit "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// GoGit is Backend reading the repository with the go-git library, it does not need git to be installed.
+//
+// Unlike git, it ignores the mailmap and does not support ignoreRevs of Blame.
+// The library checks ctx between the calls only.
+type GoGit struct {
+	dir string
+
+	// mu serializes the calls, the storage of the library is not safe for concurrent use.
+	mu   sync.Mutex
+	repo *gogit.Repository
+}
+
+// OpenGoGit returns GoGit reading the repository located in dir or any of its parents.
+func OpenGoGit(dir string) (*GoGit, error) {
+	repo, err := gogit.PlainOpenWithOptions(dir, &gogit.PlainOpenOptions{DetectDotGit: true})
+	if errors.Is(err, gogit.ErrRepositoryNotExists) {
+		return nil, fmt.Errorf("%w: %s", ErrRepositoryNotFound, dir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("go-git: %s: %w", dir, err)
+	}
+	return &GoGit{dir: dir, repo: repo}, nil
+}
+
+var _ Backend = (*GoGit)(nil)
+
+// ResolveRevision returns hash of the commit the revision points to.
+func (g *GoGit) ResolveRevision(ctx context.Context, rev string) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	c, err := g.commit(ctx, rev)
+	if err != nil {
+		return "", err
+	}
+	return c.Hash.String(), nil
+}
+
+// ListTree returns all files in the tree of the given revision,
+// limited to the subtrees of the paths if any are given.
+//
+// Submodules are skipped.
+func (g *GoGit) ListTree(ctx context.Context, rev string, paths ...string) ([]File, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	c, err := g.commit(ctx, rev)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, g.failed("ls-tree", err)
+	}
+
+	if len(paths) == 0 {
+		return g.listTree(ctx, tree, "")
+	}
+
+	var files []File
+	for _, path := range paths {
+		path = strings.TrimSuffix(path, "/")
+
+		// Paths of files list the files themselves, as with git ls-tree.
+		if f, err := tree.File(path); err == nil {
+			files = append(files, File{Path: path, Object: f.Hash.String(), Size: f.Size})
+			continue
+		}
+
+		sub, err := tree.Tree(path)
+		if errors.Is(err, object.ErrDirectoryNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, g.failed("ls-tree", err)
+		}
+
+		subtree, err := g.listTree(ctx, sub, path+"/")
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, subtree...)
+	}
+	return files, nil
+}
+
+// listTree returns all files of the tree with the prefix prepended to the paths.
+func (g *GoGit) listTree(ctx context.Context, tree *object.Tree, prefix string) ([]File, error) {
+	var files []File
+	err := tree.Files().ForEach(func(f *object.File) error {
+		files = append(files, File{Path: prefix + f.Name, Object: f.Hash.String(), Size: f.Size})
+		return ctx.Err()
+	})
+	if err != nil {
+		return nil, g.failed("ls-tree", err)
+	}
+	return files, nil
+}
+
+// Blame calls fn for every line of the file at the given revision
+// with the commit that last modified it.
+//
+// go-git blames the whole file in memory before the first call.
+func (g *GoGit) Blame(ctx context.Context, rev, path string, fn LineFunc, ignoreRevs ...string) error {
+	if len(ignoreRevs) > 0 {
+		return fmt.Errorf("go-git: blame %s: ignored revisions are not supported", path)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	c, err := g.commit(ctx, rev)
+	if err != nil {
+		return err
+	}
+
+	result, err := gogit.Blame(c, path)
+	if err != nil {
+		return g.failed("blame "+path, err)
+	}
+
+	commits := make(map[plumbing.Hash]*Commit)
+	for _, l := range result.Lines {
+		commit, ok := commits[l.Hash]
+		if !ok {
+			if commit, err = g.readCommit(ctx, l.Hash); err != nil {
+				return err
+			}
+			commits[l.Hash] = commit
+		}
+		if err := fn(commit, l.Text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LastCommit returns the last commit that modified the file at the given revision.
+func (g *GoGit) LastCommit(ctx context.Context, rev, path string) (*Commit, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	c, err := g.commit(ctx, rev)
+	if err != nil {
+		return nil, err
+	}
+
+	iter, err := g.repo.Log(&gogit.LogOptions{From: c.Hash, FileName: &path})
+	if err != nil {
+		return nil, g.failed("log", err)
+	}
+	defer iter.Close()
+
+	last, err := iter.Next()
+	if err != nil {
+		return nil, g.failed("log "+path, err)
+	}
+	return convertCommit(last), nil
+}
+
+// ReadCommit returns the commit with the hash.
+func (g *GoGit) ReadCommit(ctx context.Context, hash string) (*Commit, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.readCommit(ctx, plumbing.NewHash(hash))
+}
+
+// commit returns the commit the revision points to.
+func (g *GoGit) commit(ctx context.Context, rev string) (*object.Commit, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("go-git: %w", err)
+	}
+
+	hash, err := g.repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownRevision, rev)
+	}
+
+	c, err := g.repo.CommitObject(*hash)
+	if errors.Is(err, plumbing.ErrObjectNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownRevision, rev)
+	}
+	if err != nil {
+		return nil, g.failed("rev-parse", err)
+	}
+	return c, nil
+}
+
+func (g *GoGit) readCommit(ctx context.Context, hash plumbing.Hash) (*Commit, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("go-git: %w", err)
+	}
+
+	c, err := g.repo.CommitObject(hash)
+	if err != nil {
+		return nil, g.failed("cat-file "+hash.String(), err)
+	}
+	return convertCommit(c), nil
+}
+
+func (g *GoGit) failed(op string, err error) error {
+	return fmt.Errorf("go-git: %s: %s: %w", op, g.dir, err)
+}
+
+func convertCommit(c *object.Commit) *Commit {
+	// The summary is the first paragraph of the message, as with git log --format=%s.
+	summary, _, _ := strings.Cut(strings.TrimLeft(c.Message, "\n"), "\n\n")
+	return &Commit{
+		Hash:          c.Hash.String(),
+		Author:        c.Author.Name,
+		AuthorMail:    c.Author.Email,
+		AuthorTime:    time.Unix(c.Author.When.Unix(), 0).UTC(),
+		Committer:     c.Committer.Name,
+		CommitterMail: c.Committer.Email,
+		CommitterTime: time.Unix(c.Committer.When.Unix(), 0).UTC(),
+		Summary:       strings.ReplaceAll(strings.TrimRight(summary, "\n"), "\n", " "),
+	}
+}
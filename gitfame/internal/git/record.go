@@ -0,0 +1,342 @@
+package git
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ErrNotRecorded is returned by Replay for calls missing from the fixture.
+var ErrNotRecorded = errors.New("not recorded")
+
+// fixture is the json encoding of the responses captured by Recorder.
+type fixture struct {
+	Revisions   []fixtureRevision   `json:"revisions"`
+	Trees       []fixtureTree       `json:"trees"`
+	Blames      []fixtureBlame      `json:"blames"`
+	LastCommits []fixtureLastCommit `json:"last_commits"`
+	Commits     []*Commit           `json:"commits"`
+}
+
+type fixtureRevision struct {
+	Revision string `json:"revision"`
+	// Hash is empty for unknown revisions.
+	Hash string `json:"hash"`
+}
+
+type fixtureTree struct {
+	Revision string   `json:"revision"`
+	Paths    []string `json:"paths,omitempty"`
+	Files    []File   `json:"files"`
+}
+
+type fixtureBlame struct {
+	Revision   string        `json:"revision"`
+	Path       string        `json:"path"`
+	IgnoreRevs []string      `json:"ignore_revs,omitempty"`
+	Lines      []fixtureLine `json:"lines"`
+}
+
+type fixtureLine struct {
+	Commit string `json:"commit"`
+	Text   string `json:"text"`
+}
+
+type fixtureLastCommit struct {
+	Revision string `json:"revision"`
+	Path     string `json:"path"`
+	Commit   string `json:"commit"`
+}
+
+// responses are the recorded responses by the call arguments.
+type responses struct {
+	revisions   map[string]string
+	trees       map[string][]File
+	blames      map[string][]fixtureLine
+	lastCommits map[string]string
+	commits     map[string]*Commit
+}
+
+func newResponses() *responses {
+	return &responses{
+		revisions:   make(map[string]string),
+		trees:       make(map[string][]File),
+		blames:      make(map[string][]fixtureLine),
+		lastCommits: make(map[string]string),
+		commits:     make(map[string]*Commit),
+	}
+}
+
+// key joins the call arguments, NUL can not appear in any of them.
+func key(args ...string) string {
+	return strings.Join(args, "\x00")
+}
+
+func (r *responses) fixture() *fixture {
+	f := &fixture{}
+	for rev, hash := range r.revisions {
+		f.Revisions = append(f.Revisions, fixtureRevision{Revision: rev, Hash: hash})
+	}
+	for k, files := range r.trees {
+		args := strings.Split(k, "\x00")
+		f.Trees = append(f.Trees, fixtureTree{Revision: args[0], Paths: args[1:], Files: files})
+	}
+	for k, lines := range r.blames {
+		args := strings.Split(k, "\x00")
+		f.Blames = append(f.Blames, fixtureBlame{Revision: args[0], Path: args[1], IgnoreRevs: args[2:], Lines: lines})
+	}
+	for k, hash := range r.lastCommits {
+		rev, path, _ := strings.Cut(k, "\x00")
+		f.LastCommits = append(f.LastCommits, fixtureLastCommit{Revision: rev, Path: path, Commit: hash})
+	}
+	for _, c := range r.commits {
+		f.Commits = append(f.Commits, c)
+	}
+
+	// Sorted fixtures do not change unless the responses do.
+	slices.SortFunc(f.Revisions, func(a, b fixtureRevision) int { return cmp.Compare(a.Revision, b.Revision) })
+	slices.SortFunc(f.Trees, func(a, b fixtureTree) int {
+		return cmp.Compare(key(append([]string{a.Revision}, a.Paths...)...), key(append([]string{b.Revision}, b.Paths...)...))
+	})
+	slices.SortFunc(f.Blames, func(a, b fixtureBlame) int {
+		return cmp.Compare(key(append([]string{a.Revision, a.Path}, a.IgnoreRevs...)...),
+			key(append([]string{b.Revision, b.Path}, b.IgnoreRevs...)...))
+	})
+	slices.SortFunc(f.LastCommits, func(a, b fixtureLastCommit) int {
+		return cmp.Compare(key(a.Revision, a.Path), key(b.Revision, b.Path))
+	})
+	slices.SortFunc(f.Commits, func(a, b *Commit) int { return cmp.Compare(a.Hash, b.Hash) })
+	return f
+}
+
+func (f *fixture) responses() (*responses, error) {
+	r := newResponses()
+	for _, rev := range f.Revisions {
+		r.revisions[rev.Revision] = rev.Hash
+	}
+	for _, t := range f.Trees {
+		r.trees[key(append([]string{t.Revision}, t.Paths...)...)] = t.Files
+	}
+	for _, c := range f.Commits {
+		r.commits[c.Hash] = c
+	}
+	for _, b := range f.Blames {
+		for _, l := range b.Lines {
+			if r.commits[l.Commit] == nil {
+				return nil, fmt.Errorf("blame %s: unknown commit %s", b.Path, l.Commit)
+			}
+		}
+		r.blames[key(append([]string{b.Revision, b.Path}, b.IgnoreRevs...)...)] = b.Lines
+	}
+	for _, l := range f.LastCommits {
+		if r.commits[l.Commit] == nil {
+			return nil, fmt.Errorf("last commit of %s: unknown commit %s", l.Path, l.Commit)
+		}
+		r.lastCommits[key(l.Revision, l.Path)] = l.Commit
+	}
+	return r, nil
+}
+
+// Recorder is Backend capturing the responses of another backend, see Replay.
+//
+// Failures other than unknown revisions are not recorded.
+type Recorder struct {
+	backend Backend
+
+	mu        sync.Mutex
+	responses *responses
+}
+
+// NewRecorder returns Recorder of the responses of the backend.
+func NewRecorder(backend Backend) *Recorder {
+	return &Recorder{backend: backend, responses: newResponses()}
+}
+
+var _ Backend = (*Recorder)(nil)
+
+// ResolveRevision returns hash of the commit the revision points to.
+func (r *Recorder) ResolveRevision(ctx context.Context, rev string) (string, error) {
+	hash, err := r.backend.ResolveRevision(ctx, rev)
+	if err != nil && !errors.Is(err, ErrUnknownRevision) {
+		return "", err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.responses.revisions[rev] = hash
+	return hash, err
+}
+
+// ListTree returns all files in the tree of the given revision,
+// limited to the subtrees of the paths if any are given.
+func (r *Recorder) ListTree(ctx context.Context, rev string, paths ...string) ([]File, error) {
+	files, err := r.backend.ListTree(ctx, rev, paths...)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.responses.trees[key(append([]string{rev}, paths...)...)] = files
+	return files, nil
+}
+
+// Blame calls fn for every line of the file at the given revision
+// with the commit that last modified it.
+func (r *Recorder) Blame(ctx context.Context, rev, path string, fn LineFunc, ignoreRevs ...string) error {
+	var recorded []fixtureLine
+	commits := make(map[string]*Commit)
+	err := r.backend.Blame(ctx, rev, path, func(commit *Commit, text string) error {
+		commits[commit.Hash] = commit
+		recorded = append(recorded, fixtureLine{Commit: commit.Hash, Text: text})
+		return fn(commit, text)
+	}, ignoreRevs...)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for hash, c := range commits {
+		r.responses.commits[hash] = c
+	}
+	if recorded == nil {
+		recorded = []fixtureLine{}
+	}
+	r.responses.blames[key(append([]string{rev, path}, ignoreRevs...)...)] = recorded
+	return nil
+}
+
+// LastCommit returns the last commit that modified the file at the given revision.
+func (r *Recorder) LastCommit(ctx context.Context, rev, path string) (*Commit, error) {
+	c, err := r.backend.LastCommit(ctx, rev, path)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.responses.commits[c.Hash] = c
+	r.responses.lastCommits[key(rev, path)] = c.Hash
+	return c, nil
+}
+
+// ReadCommit returns the commit with the hash.
+func (r *Recorder) ReadCommit(ctx context.Context, hash string) (*Commit, error) {
+	c, err := r.backend.ReadCommit(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.responses.commits[c.Hash] = c
+	return c, nil
+}
+
+// Save writes the recorded responses to the fixture file read by OpenReplay.
+func (r *Recorder) Save(path string) error {
+	r.mu.Lock()
+	data, err := json.MarshalIndent(r.responses.fixture(), "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// Replay is Backend serving the responses captured by Recorder,
+// calls missing from the fixture fail with ErrNotRecorded.
+//
+// Lines of the same commit share the Commit, as with the other backends.
+type Replay struct {
+	path      string
+	responses *responses
+}
+
+// OpenReplay returns Replay serving the fixture file written by Recorder.Save.
+func OpenReplay(path string) (*Replay, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var f fixture
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	responses, err := f.responses()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &Replay{path: path, responses: responses}, nil
+}
+
+var _ Backend = (*Replay)(nil)
+
+func (r *Replay) notRecorded(op string, args ...string) error {
+	return fmt.Errorf("%s: %s %s: %w", r.path, op, strings.Join(args, " "), ErrNotRecorded)
+}
+
+// ResolveRevision returns hash of the commit the revision points to.
+func (r *Replay) ResolveRevision(ctx context.Context, rev string) (string, error) {
+	hash, ok := r.responses.revisions[rev]
+	if !ok {
+		return "", r.notRecorded("rev-parse", rev)
+	}
+	if hash == "" {
+		return "", fmt.Errorf("%w: %s", ErrUnknownRevision, rev)
+	}
+	return hash, nil
+}
+
+// ListTree returns all files in the tree of the given revision,
+// limited to the subtrees of the paths if any are given.
+func (r *Replay) ListTree(ctx context.Context, rev string, paths ...string) ([]File, error) {
+	files, ok := r.responses.trees[key(append([]string{rev}, paths...)...)]
+	if !ok {
+		return nil, r.notRecorded("ls-tree", append([]string{rev}, paths...)...)
+	}
+	return slices.Clone(files), nil
+}
+
+// Blame calls fn for every line of the file at the given revision
+// with the commit that last modified it.
+func (r *Replay) Blame(ctx context.Context, rev, path string, fn LineFunc, ignoreRevs ...string) error {
+	recorded, ok := r.responses.blames[key(append([]string{rev, path}, ignoreRevs...)...)]
+	if !ok {
+		return r.notRecorded("blame", append([]string{rev, path}, ignoreRevs...)...)
+	}
+
+	for _, l := range recorded {
+		if err := fn(r.responses.commits[l.Commit], l.Text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LastCommit returns the last commit that modified the file at the given revision.
+func (r *Replay) LastCommit(ctx context.Context, rev, path string) (*Commit, error) {
+	hash, ok := r.responses.lastCommits[key(rev, path)]
+	if !ok {
+		return nil, r.notRecorded("log", rev, path)
+	}
+	return r.responses.commits[hash], nil
+}
+
+// ReadCommit returns the commit with the hash.
+func (r *Replay) ReadCommit(ctx context.Context, hash string) (*Commit, error) {
+	c, ok := r.responses.commits[hash]
+	if !ok {
+		return nil, r.notRecorded("cat-file", hash)
+	}
+	return c, nil
+}
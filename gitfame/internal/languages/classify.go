@@ -0,0 +1,110 @@
+package languages
+
+import "strings"
+
+// Kind is the kind of a line of source code.
+type Kind int
+
+// Kinds of lines.
+const (
+	// Code lines hold anything but whitespace and comments.
+	Code Kind = iota
+	// Comment lines hold comments and whitespace only.
+	Comment
+	// Blank lines hold whitespace only.
+	Blank
+)
+
+// Classifier tells kinds of consecutive lines of a single file apart.
+//
+// Comment markers are looked up literally, markers inside string literals
+// are taken for comments too. Files of languages without comment syntax
+// have code and blank lines only.
+type Classifier struct {
+	lang *Language
+	// end is the marker ending the block comment the previous line left open.
+	end string
+}
+
+// NewClassifier returns the Classifier of a file of the language.
+func NewClassifier(lang Language) *Classifier {
+	return &Classifier{lang: &lang}
+}
+
+// Classify returns the kind of the next line of the file.
+func (c *Classifier) Classify(line string) Kind {
+	rest := line
+	comment := false
+
+	for {
+		if c.end != "" {
+			i := strings.Index(rest, c.end)
+			if i < 0 {
+				return Comment
+			}
+			rest, c.end, comment = rest[i+len(c.end):], "", true
+		}
+
+		rest = strings.TrimSpace(rest)
+		switch {
+		case rest == "" && comment:
+			return Comment
+		case rest == "":
+			return Blank
+		}
+
+		// Block comment markers may start with line comment ones, e.g. "--[[" and "--".
+		if end, n := c.startsBlockComment(rest); n > 0 {
+			rest, c.end, comment = rest[n:], end, true
+			continue
+		}
+		if c.startsLineComment(rest) {
+			return Comment
+		}
+
+		// The line holds code, a block comment may still start after it.
+		c.skipCode(rest)
+		return Code
+	}
+}
+
+func (c *Classifier) startsLineComment(s string) bool {
+	for _, marker := range c.lang.LineComment {
+		if strings.HasPrefix(s, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// startsBlockComment returns the end marker and the length of the start marker
+// of the block comment s starts with, the longest start marker wins.
+func (c *Classifier) startsBlockComment(s string) (end string, n int) {
+	for _, markers := range c.lang.BlockComment {
+		if strings.HasPrefix(s, markers[0]) && len(markers[0]) > n {
+			end, n = markers[1], len(markers[0])
+		}
+	}
+	return end, n
+}
+
+// skipCode finds the block comment left open at the end of the code line.
+func (c *Classifier) skipCode(s string) {
+	for i := 0; i < len(s); i++ {
+		rest := s[i:]
+		end, n := c.startsBlockComment(rest)
+		if n == 0 {
+			if c.startsLineComment(rest) {
+				return
+			}
+			continue
+		}
+
+		j := strings.Index(rest[n:], end)
+		if j < 0 {
+			c.end = end
+			return
+		}
+		i += n + j + len(end) - 1
+	}
+}
@@ -0,0 +1,102 @@
+package languages
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifier(t *testing.T) {
+	c := Language{LineComment: []string{"//"}, BlockComment: [][]string{{"/*", "*/"}}}
+	lua := Language{LineComment: []string{"--"}, BlockComment: [][]string{{"--[[", "]]"}}}
+
+	for _, tc := range []struct {
+		name  string
+		lang  Language
+		lines string
+		kinds []Kind
+	}{
+		{
+			name:  "line comments",
+			lang:  c,
+			lines: "// doc\nx := 1 // trailing\n\t \n  // indented",
+			kinds: []Kind{Comment, Code, Blank, Comment},
+		},
+		{
+			name:  "block comments",
+			lang:  c,
+			lines: "/*\n\n * text\n */\nx := 1",
+			kinds: []Kind{Comment, Comment, Comment, Comment, Code},
+		},
+		{
+			name:  "code around block comments",
+			lang:  c,
+			lines: "/* a */ x := 1\nx := 1 /* b\n*/ y := 2\n/* c */ /* d */",
+			kinds: []Kind{Code, Code, Code, Comment},
+		},
+		{
+			name:  "block comment after line comment marker",
+			lang:  c,
+			lines: "x := 1 // /*\ny := 2",
+			kinds: []Kind{Code, Code},
+		},
+		{
+			name:  "longest marker",
+			lang:  lua,
+			lines: "--[[\nx = 1\n]]\n-- y = 2",
+			kinds: []Kind{Comment, Comment, Comment, Comment},
+		},
+		{
+			name:  "no comment syntax",
+			lang:  Language{},
+			lines: "// x\n\n/* y */",
+			kinds: []Kind{Code, Blank, Code},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			classifier := NewClassifier(tc.lang)
+
+			var kinds []Kind
+			for _, line := range strings.Split(tc.lines, "\n") {
+				kinds = append(kinds, classifier.Classify(line))
+			}
+			require.Equal(t, tc.kinds, kinds)
+		})
+	}
+}
+
+func TestForPath(t *testing.T) {
+	m, err := New([]Language{
+		{Name: "Text", Extensions: []string{".h"}},
+		{Name: "C", Extensions: []string{".c", ".h"}, LineComment: []string{"//"}},
+		{Name: "TypeScript", Extensions: []string{".ts"}},
+		{Name: "Declarations", Extensions: []string{".d.ts"}},
+	})
+	require.NoError(t, err)
+
+	for path, name := range map[string]string{
+		"main.c":          "C",
+		"include/a.h":     "C",
+		"src/index.ts":    "TypeScript",
+		"types/all.d.ts":  "Declarations",
+		"Makefile":        "",
+		"dir.c/README":    "",
+		"archive.tar.bz2": "",
+	} {
+		l, ok := m.ForPath(path)
+		require.Equal(t, name != "", ok, path)
+		require.Equal(t, name, l.Name, path)
+	}
+}
+
+func TestNewRejectsMalformedComments(t *testing.T) {
+	for _, l := range []Language{
+		{Name: "A", LineComment: []string{" "}},
+		{Name: "B", BlockComment: [][]string{{"/*"}}},
+		{Name: "C", BlockComment: [][]string{{"/*", ""}}},
+	} {
+		_, err := New([]Language{l})
+		require.Error(t, err, l.Name)
+	}
+}
@@ -0,0 +1,265 @@
+// Package languages maps programming, markup and other languages to file extensions.
+package languages
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+
+	"gitlab.com/slon/shad-go/gitfame/configs"
+)
+
+// Language describes a single language of the mapping.
+type Language struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type,omitempty"`
+	Extensions []string `json:"extensions,omitempty"`
+	// LineComment lists markers starting comments that last until the end of the line, e.g. "//".
+	LineComment []string `json:"line_comment,omitempty"`
+	// BlockComment lists pairs of markers starting and ending comments, e.g. ["/*", "*/"].
+	BlockComment [][]string `json:"block_comment,omitempty"`
+}
+
+// Mapping is a validated list of languages with unique names.
+type Mapping struct {
+	languages []Language
+	// byName maps lowercased language names to indices in languages.
+	byName map[string]int
+	// byExtension maps extensions to indices in languages, built on the first ForPath.
+	byExtension     map[string]int
+	byExtensionOnce sync.Once
+}
+
+var (
+	defaultOnce    sync.Once
+	defaultMapping *Mapping
+	defaultErr     error
+)
+
+// Default returns the built-in mapping embedded into the binary.
+func Default() (*Mapping, error) {
+	defaultOnce.Do(func() {
+		defaultMapping, defaultErr = Parse(bytes.NewReader(configs.LanguageExtensions))
+		if defaultErr != nil {
+			defaultErr = fmt.Errorf("built-in language mapping: %w", defaultErr)
+		}
+	})
+	return defaultMapping, defaultErr
+}
+
+// Load reads the mapping from a JSON file.
+func Load(path string) (*Mapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return m, nil
+}
+
+// Parse decodes and validates the mapping.
+//
+// The input is a JSON array of objects with "name", "type", "extensions",
+// "line_comment" and "block_comment" fields.
+func Parse(r io.Reader) (*Mapping, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	var languages []Language
+	if err := dec.Decode(&languages); err != nil {
+		return nil, fmt.Errorf("malformed language mapping: %w", err)
+	}
+
+	return New(languages)
+}
+
+// New validates languages and builds a mapping out of them.
+func New(languages []Language) (*Mapping, error) {
+	m := &Mapping{byName: make(map[string]int, len(languages))}
+
+	for i, l := range languages {
+		if strings.TrimSpace(l.Name) == "" {
+			return nil, fmt.Errorf("language #%d: empty name", i+1)
+		}
+
+		key := strings.ToLower(l.Name)
+		if j, ok := m.byName[key]; ok {
+			return nil, fmt.Errorf("language #%d %q: duplicate name, already defined by language #%d", i+1, l.Name, j+1)
+		}
+
+		for _, ext := range l.Extensions {
+			if err := validateExtension(ext); err != nil {
+				return nil, fmt.Errorf("language #%d %q: %w", i+1, l.Name, err)
+			}
+		}
+
+		if err := validateComments(&l); err != nil {
+			return nil, fmt.Errorf("language #%d %q: %w", i+1, l.Name, err)
+		}
+
+		m.byName[key] = len(m.languages)
+		m.languages = append(m.languages, l)
+	}
+
+	return m, nil
+}
+
+func validateExtension(ext string) error {
+	switch {
+	case !strings.HasPrefix(ext, "."):
+		return fmt.Errorf("malformed extension %q: must start with a dot", ext)
+	case len(ext) == 1 || strings.HasSuffix(ext, "."):
+		return fmt.Errorf("malformed extension %q: must not end with a dot", ext)
+	case strings.ContainsAny(ext, `/\`):
+		return fmt.Errorf("malformed extension %q: must not contain path separators", ext)
+	case strings.IndexFunc(ext, unicode.IsSpace) >= 0:
+		return fmt.Errorf("malformed extension %q: must not contain spaces", ext)
+	}
+	return nil
+}
+
+func validateComments(l *Language) error {
+	for _, marker := range l.LineComment {
+		if strings.TrimSpace(marker) == "" {
+			return fmt.Errorf("empty line comment marker")
+		}
+	}
+	for _, markers := range l.BlockComment {
+		if len(markers) != 2 {
+			return fmt.Errorf("malformed block comment %q: expected start and end markers", markers)
+		}
+		if strings.TrimSpace(markers[0]) == "" || strings.TrimSpace(markers[1]) == "" {
+			return fmt.Errorf("malformed block comment %q: empty marker", markers)
+		}
+	}
+	return nil
+}
+
+// Languages returns languages of the mapping in definition order.
+func (m *Mapping) Languages() []Language {
+	return m.languages
+}
+
+// Lookup finds the language by its case-insensitive name.
+func (m *Mapping) Lookup(name string) (Language, bool) {
+	i, ok := m.byName[strings.ToLower(name)]
+	if !ok {
+		return Language{}, false
+	}
+	return m.languages[i], true
+}
+
+// ForPath finds the language of the file by the longest matching extension.
+//
+// Languages with comment syntax take precedence over the ones without it
+// sharing the extension, otherwise the first defined language wins.
+func (m *Mapping) ForPath(path string) (Language, bool) {
+	m.byExtensionOnce.Do(m.indexExtensions)
+
+	name := path[strings.LastIndex(path, "/")+1:]
+	for i := 0; i < len(name); i++ {
+		if name[i] != '.' {
+			continue
+		}
+		if j, ok := m.byExtension[name[i:]]; ok {
+			return m.languages[j], true
+		}
+	}
+	return Language{}, false
+}
+
+func (m *Mapping) indexExtensions() {
+	m.byExtension = make(map[string]int)
+	for i, l := range m.languages {
+		for _, ext := range l.Extensions {
+			j, ok := m.byExtension[ext]
+			if !ok || !m.languages[j].hasComments() && l.hasComments() {
+				m.byExtension[ext] = i
+			}
+		}
+	}
+}
+
+func (l *Language) hasComments() bool {
+	return len(l.LineComment) > 0 || len(l.BlockComment) > 0
+}
+
+// Merge returns a new mapping with languages of other put on top of m.
+//
+// Languages of other replace the ones of m with the same name,
+// the rest of them are appended to the end.
+func (m *Mapping) Merge(other *Mapping) *Mapping {
+	merged := &Mapping{
+		languages: append([]Language(nil), m.languages...),
+		byName:    make(map[string]int, len(m.languages)+len(other.languages)),
+	}
+	for k, v := range m.byName {
+		merged.byName[k] = v
+	}
+
+	for _, l := range other.languages {
+		key := strings.ToLower(l.Name)
+		if i, ok := merged.byName[key]; ok {
+			merged.languages[i] = l
+			continue
+		}
+
+		merged.byName[key] = len(merged.languages)
+		merged.languages = append(merged.languages, l)
+	}
+
+	return merged
+}
+
+// Extensions returns the union of extensions of the named languages.
+//
+// Names missing from the mapping are returned in unknown.
+func (m *Mapping) Extensions(names []string) (extensions, unknown []string) {
+	for _, name := range names {
+		l, ok := m.Lookup(name)
+		if !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		extensions = append(extensions, l.Extensions...)
+	}
+	return extensions, unknown
+}
+
+// LoadConfig returns the mapping selected by the --languages-config flags:
+// the built-in one if path is empty, the one read from path,
+// or the latter merged on top of the former if merge is set.
+func LoadConfig(path string, merge bool) (*Mapping, error) {
+	if path == "" {
+		if merge {
+			return nil, fmt.Errorf("--languages-config-merge requires --languages-config")
+		}
+		return Default()
+	}
+
+	custom, err := Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("languages config: %w", err)
+	}
+
+	if !merge {
+		return custom, nil
+	}
+
+	builtin, err := Default()
+	if err != nil {
+		return nil, err
+	}
+
+	return builtin.Merge(custom), nil
+}
@@ -0,0 +1,373 @@
+// Package porcelain parses the output of git blame --porcelain as a stream.
+//
+// The output is a sequence of groups of consecutive lines last modified by the
+// same commit. The first line of a group starts with the header
+//
+//	<hash> <orig-line> <final-line> <group-lines>
+//
+// followed by the commit metadata, printed the first time the commit shows up,
+// and the line contents prefixed with a tab. Other lines of the group start with
+// the "<hash> <orig-line> <final-line>" header.
+package porcelain
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits used by NewParser unless overridden.
+const (
+	DefaultMaxLineSize   = 1 << 20
+	DefaultMaxGroupLines = 4096
+)
+
+// ErrLineTooLong is returned for lines of the output longer than the limit, see WithMaxLineSize.
+var ErrLineTooLong = errors.New("porcelain: line too long")
+
+// Commit is the metadata of a commit reported by git blame.
+type Commit struct {
+	Hash          string
+	Author        string
+	AuthorMail    string
+	AuthorTime    time.Time
+	AuthorTZ      string
+	Committer     string
+	CommitterMail string
+	CommitterTime time.Time
+	CommitterTZ   string
+	Summary       string
+
+	// Boundary is set for the boundary commits, e.g. the root one.
+	Boundary bool
+	// Previous and PreviousFilename are the parent commit and the path
+	// the lines were taken from, set unless the commit added them.
+	Previous         string
+	PreviousFilename string
+}
+
+// Group is a run of consecutive lines of the blamed file last modified by the same commit.
+type Group struct {
+	// Commit is shared by all groups of the commit.
+	Commit *Commit
+	// Filename is the path of the file in Commit.
+	Filename string
+	// OrigLine and FinalLine are the numbers of the first line of the group
+	// in the file of Commit and in the blamed file, starting from 1.
+	OrigLine  int
+	FinalLine int
+	// Lines are the contents of the lines without the leading tab and the trailing newline.
+	Lines []string
+}
+
+// Option configures Parser.
+type Option func(*Parser)
+
+// WithMaxLineSize limits the length of a single line of the output, DefaultMaxLineSize by default.
+func WithMaxLineSize(n int) Option {
+	return func(p *Parser) { p.maxLineSize = n }
+}
+
+// WithMaxGroupLines limits the number of lines of a returned group, DefaultMaxGroupLines by default.
+// Longer groups are returned in several consecutive parts, n is at least 1.
+func WithMaxGroupLines(n int) Option {
+	return func(p *Parser) { p.maxGroupLines = n }
+}
+
+// Parser reads groups from the output of git blame --porcelain.
+//
+// Memory is bounded by the limits of a single line and a single group
+// and by the metadata of the seen commits.
+type Parser struct {
+	r             *bufio.Reader
+	maxLineSize   int
+	maxGroupLines int
+
+	// line is the number of the last read line of the output.
+	line int
+	buf  []byte
+
+	commits   map[string]*Commit
+	filenames map[*Commit]string
+
+	// rest is the unread part of a group split by maxGroupLines.
+	rest struct {
+		commit   *Commit
+		filename string
+		orig     int
+		final    int
+		lines    int
+	}
+}
+
+// NewParser returns Parser reading the output from r.
+func NewParser(r io.Reader, opts ...Option) *Parser {
+	p := &Parser{
+		r:             bufio.NewReader(r),
+		maxLineSize:   DefaultMaxLineSize,
+		maxGroupLines: DefaultMaxGroupLines,
+		commits:       make(map[string]*Commit),
+		filenames:     make(map[*Commit]string),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	p.maxGroupLines = max(p.maxGroupLines, 1)
+	return p
+}
+
+// Next returns the next group. It returns io.EOF at the end of the output
+// and an error wrapping io.ErrUnexpectedEOF if the output ends in the middle of a group.
+func (p *Parser) Next() (*Group, error) {
+	g, err := p.next()
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("porcelain: line %d: %w", p.line, err)
+	}
+	return g, err
+}
+
+func (p *Parser) next() (*Group, error) {
+	if p.rest.lines > 0 {
+		g := &Group{Commit: p.rest.commit, Filename: p.rest.filename, OrigLine: p.rest.orig, FinalLine: p.rest.final}
+		return g, p.readLines(g, p.rest.lines)
+	}
+
+	header, err := p.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	fields := strings.Fields(string(header))
+	if len(fields) != 4 {
+		return nil, fmt.Errorf("malformed group header %q", header)
+	}
+
+	c, err := p.commit(fields[0])
+	if err != nil {
+		return nil, err
+	}
+
+	numbers, err := parseNumbers(fields[1:])
+	if err != nil {
+		return nil, fmt.Errorf("malformed group header %q: %w", header, err)
+	}
+
+	g := &Group{Commit: c, OrigLine: numbers[0], FinalLine: numbers[1]}
+	text, err := p.readMetadata(c)
+	if err != nil {
+		return nil, err
+	}
+
+	g.Filename = p.filenames[c]
+	if g.Filename == "" {
+		return nil, fmt.Errorf("no filename for commit %s", c.Hash)
+	}
+
+	g.Lines = append(g.Lines, text)
+	return g, p.readLines(g, numbers[2]-1)
+}
+
+// commit returns the commit with the hash, creating it on the first call.
+func (p *Parser) commit(hash string) (*Commit, error) {
+	if !isHash(hash) {
+		return nil, fmt.Errorf("malformed commit hash %q", hash)
+	}
+
+	c, ok := p.commits[hash]
+	if !ok {
+		c = &Commit{Hash: hash}
+		p.commits[hash] = c
+	}
+	return c, nil
+}
+
+// readMetadata reads the headers of the commit up to the first line contents.
+func (p *Parser) readMetadata(c *Commit) (string, error) {
+	for {
+		line, err := p.readLine()
+		if err == io.EOF {
+			return "", io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if len(line) > 0 && line[0] == '\t' {
+			return string(line[1:]), nil
+		}
+
+		key, value, _ := strings.Cut(string(line), " ")
+		if err := p.setField(c, key, value); err != nil {
+			return "", err
+		}
+	}
+}
+
+// readLines reads n lines of the group g following the already read ones,
+// the rest is left for the next call if g reaches maxGroupLines.
+func (p *Parser) readLines(g *Group, n int) error {
+	p.rest.lines = 0
+
+	for i := 0; i < n; i++ {
+		if len(g.Lines) >= p.maxGroupLines {
+			p.rest.commit, p.rest.filename = g.Commit, g.Filename
+			p.rest.orig, p.rest.final = g.OrigLine+len(g.Lines), g.FinalLine+len(g.Lines)
+			p.rest.lines = n - i
+			return nil
+		}
+
+		header, err := p.readLine()
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+
+		fields := strings.Fields(string(header))
+		if len(fields) != 3 || fields[0] != g.Commit.Hash {
+			return fmt.Errorf("malformed line header %q in group of commit %s", header, g.Commit.Hash)
+		}
+
+		numbers, err := parseNumbers(fields[1:])
+		if err != nil {
+			return fmt.Errorf("malformed line header %q: %w", header, err)
+		}
+		if numbers[0] != g.OrigLine+len(g.Lines) || numbers[1] != g.FinalLine+len(g.Lines) {
+			return fmt.Errorf("line header %q breaks the group of commit %s", header, g.Commit.Hash)
+		}
+
+		text, err := p.readLine()
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+		if len(text) == 0 || text[0] != '\t' {
+			return fmt.Errorf("expected line contents, got %q", text)
+		}
+
+		g.Lines = append(g.Lines, string(text[1:]))
+	}
+
+	return nil
+}
+
+// readLine returns the next line without the trailing newline, valid until the next call.
+func (p *Parser) readLine() ([]byte, error) {
+	p.buf = p.buf[:0]
+	for {
+		chunk, err := p.r.ReadSlice('\n')
+		p.buf = append(p.buf, chunk...)
+		if len(bytes.TrimSuffix(p.buf, []byte{'\n'})) > p.maxLineSize {
+			return nil, ErrLineTooLong
+		}
+
+		switch {
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF && len(p.buf) > 0:
+			// The last line misses the newline.
+			p.line++
+			return p.buf, nil
+		case err != nil:
+			return nil, err
+		}
+
+		p.line++
+		return p.buf[:len(p.buf)-1], nil
+	}
+}
+
+// setField fills the commit field corresponding to the header key.
+// Unknown keys are ignored.
+func (p *Parser) setField(c *Commit, key, value string) error {
+	var err error
+	switch key {
+	case "author":
+		c.Author = value
+	case "author-mail":
+		c.AuthorMail = strings.TrimSuffix(strings.TrimPrefix(value, "<"), ">")
+	case "author-time":
+		c.AuthorTime, err = parseUnixTime(value)
+	case "author-tz":
+		c.AuthorTZ = value
+	case "committer":
+		c.Committer = value
+	case "committer-mail":
+		c.CommitterMail = strings.TrimSuffix(strings.TrimPrefix(value, "<"), ">")
+	case "committer-time":
+		c.CommitterTime, err = parseUnixTime(value)
+	case "committer-tz":
+		c.CommitterTZ = value
+	case "summary":
+		c.Summary = value
+	case "boundary":
+		c.Boundary = true
+	case "previous":
+		hash, filename, ok := strings.Cut(value, " ")
+		if !ok || !isHash(hash) {
+			return fmt.Errorf("malformed previous header %q", value)
+		}
+		c.Previous = hash
+		c.PreviousFilename, err = unquote(filename)
+	case "filename":
+		var filename string
+		if filename, err = unquote(value); err == nil {
+			p.filenames[c] = filename
+		}
+	}
+	return err
+}
+
+// unquote decodes paths git quotes in the C style, e.g. the ones with tabs or quotes.
+func unquote(s string) (string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return s, nil
+	}
+	u, err := strconv.Unquote(s)
+	if err != nil {
+		return "", fmt.Errorf("malformed quoted path %s", s)
+	}
+	return u, nil
+}
+
+func parseNumbers(fields []string) ([]int, error) {
+	numbers := make([]int, len(fields))
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("malformed number %q", f)
+		}
+		numbers[i] = n
+	}
+	return numbers, nil
+}
+
+func parseUnixTime(s string) (time.Time, error) {
+	sec, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("malformed timestamp %q", s)
+	}
+	return time.Unix(sec, 0).UTC(), nil
+}
+
+// isHash reports whether s looks like a full SHA-1 or SHA-256 object name.
+func isHash(s string) bool {
+	if len(s) != 40 && len(s) != 64 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,215 @@
+package porcelain
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func readGroups(t testing.TB, p *Parser) ([]*Group, error) {
+	t.Helper()
+
+	var groups []*Group
+	for {
+		g, err := p.Next()
+		if err == io.EOF {
+			return groups, nil
+		}
+		if err != nil {
+			return groups, err
+		}
+		groups = append(groups, g)
+	}
+}
+
+func parseFile(t *testing.T, name string, opts ...Option) []*Group {
+	t.Helper()
+
+	f, err := os.Open(filepath.Join("testdata", name))
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+
+	groups, err := readGroups(t, NewParser(f, opts...))
+	require.NoError(t, err)
+	return groups
+}
+
+func TestParserTabsInAuthor(t *testing.T) {
+	groups := parseFile(t, "tabby.porcelain")
+	require.Len(t, groups, 1)
+
+	g := groups[0]
+	require.Equal(t, "main.go", g.Filename)
+	require.Equal(t, 1, g.OrigLine)
+	require.Equal(t, 1, g.FinalLine)
+	require.Equal(t, []string{"package main", "", `import "fmt"`, "", "func main() {", "\tfmt.Println(\"breaker\")", "}"}, g.Lines)
+	require.Equal(t, &Commit{
+		Hash:          "400683875aad1234a51d9fe6e8b6137556702ae6",
+		Author:        "My\tname\tis\tTabby",
+		AuthorMail:    "tabby@example.com",
+		AuthorTime:    time.Unix(1614525319, 0).UTC(),
+		AuthorTZ:      "+0300",
+		Committer:     "My\tname\tis\tTabby",
+		CommitterMail: "tabby@example.com",
+		CommitterTime: time.Unix(1614525319, 0).UTC(),
+		CommitterTZ:   "+0300",
+		Summary:       "Add main.go",
+	}, g.Commit)
+}
+
+func TestParserBoundaryAndSpaces(t *testing.T) {
+	groups := parseFile(t, "spaces.porcelain")
+	require.Len(t, groups, 1)
+
+	g := groups[0]
+	require.Equal(t, "read me.md", g.Filename)
+	require.True(t, g.Commit.Boundary)
+	require.Empty(t, g.Commit.Previous)
+	require.Equal(t, "Brad Fitzpatrick", g.Commit.Author)
+	require.Equal(t, []string{"# Breaker!", "", "I'have a space in my name.", ""}, g.Lines)
+}
+
+func TestParserPrevious(t *testing.T) {
+	groups := parseFile(t, "previous.porcelain")
+	require.Len(t, groups, 3)
+
+	require.Equal(t, 5, len(groups[0].Lines))
+	require.Equal(t, "9db7731746bfc069375e397f0d56c0c11396b421", groups[1].Commit.Previous)
+	require.Equal(t, "hello.go", groups[1].Commit.PreviousFilename)
+	require.Equal(t, []string{"\tfmt.Println(\"Hello, World!\")"}, groups[1].Lines)
+
+	// The commit details are printed once, later groups share them.
+	require.Same(t, groups[0].Commit, groups[2].Commit)
+	require.Equal(t, "hello.go", groups[2].Filename)
+	require.Equal(t, 7, groups[2].FinalLine)
+}
+
+func TestParserQuotedFilename(t *testing.T) {
+	groups := parseFile(t, "quoted.porcelain")
+	require.Len(t, groups, 3)
+
+	const filename = "we ird\tname\".txt"
+	for _, g := range groups {
+		require.Equal(t, filename, g.Filename)
+	}
+
+	require.Equal(t, "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUV\tWXYZ!\"#$%&'()*+,-./:;=?@[\\]^_`{|}~", groups[0].Commit.Author)
+	require.True(t, groups[0].Commit.Boundary)
+	require.Equal(t, filename, groups[1].Commit.PreviousFilename)
+	require.Same(t, groups[0].Commit, groups[2].Commit)
+	require.Equal(t, 2, groups[2].OrigLine)
+	require.Equal(t, 3, groups[2].FinalLine)
+}
+
+func TestParserEmpty(t *testing.T) {
+	// Blame of an empty file, e.g. the ones added by the empty commits, prints nothing.
+	groups, err := readGroups(t, NewParser(strings.NewReader("")))
+	require.NoError(t, err)
+	require.Empty(t, groups)
+}
+
+func TestParserMaxGroupLines(t *testing.T) {
+	groups := parseFile(t, "tabby.porcelain", WithMaxGroupLines(3))
+	require.Len(t, groups, 3)
+
+	var lines []string
+	for i, g := range groups {
+		require.Same(t, groups[0].Commit, g.Commit)
+		require.Equal(t, "main.go", g.Filename)
+		require.Equal(t, 1+3*i, g.OrigLine)
+		require.Equal(t, 1+3*i, g.FinalLine)
+		lines = append(lines, g.Lines...)
+	}
+	require.Equal(t, []int{3, 3, 1}, []int{len(groups[0].Lines), len(groups[1].Lines), len(groups[2].Lines)})
+	require.Len(t, lines, 7)
+}
+
+func TestParserMissingFinalNewline(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "spaces.porcelain"))
+	require.NoError(t, err)
+
+	groups, err := readGroups(t, NewParser(strings.NewReader(strings.TrimSuffix(string(data), "\n"))))
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	require.Len(t, groups[0].Lines, 4)
+}
+
+func TestParserErrors(t *testing.T) {
+	const hash = "d5e9958063725c54e82b2e77427bd0dcbaf43fef"
+	const other = "400683875aad1234a51d9fe6e8b6137556702ae6"
+
+	for _, tc := range []struct {
+		name   string
+		input  string
+		opts   []Option
+		target error
+	}{
+		{name: "content before header", input: "\tline\n"},
+		{name: "malformed header", input: hash + " 1 1\nfilename a\n\tline\n"},
+		{name: "malformed hash", input: "xyz 1 1 1\nfilename a\n\tline\n"},
+		{name: "zero line", input: hash + " 0 1 1\nfilename a\n\tline\n"},
+		{name: "missing filename", input: hash + " 1 1 1\nauthor a\n\tline\n"},
+		{name: "malformed time", input: hash + " 1 1 1\nauthor-time yesterday\nfilename a\n\tline\n"},
+		{name: "malformed previous", input: hash + " 1 1 1\nprevious a\nfilename a\n\tline\n"},
+		{name: "malformed quoted filename", input: hash + " 1 1 1\nfilename \"a\n\tline\n"},
+		{name: "other commit in group", input: hash + " 1 1 2\nfilename a\n\tline\n" + other + " 2 2\n\tline\n"},
+		{name: "gap in group", input: hash + " 1 1 2\nfilename a\n\tline\n" + hash + " 3 3\n\tline\n"},
+		{name: "missing contents", input: hash + " 1 1 2\nfilename a\n\tline\n" + hash + " 2 2\n" + hash + " 3 3\n"},
+		{name: "truncated metadata", input: hash + " 1 1 1\nfilename a\n", target: io.ErrUnexpectedEOF},
+		{name: "truncated group", input: hash + " 1 1 2\nfilename a\n\tline\n", target: io.ErrUnexpectedEOF},
+		{
+			name:   "long line",
+			input:  hash + " 1 1 1\nfilename a\n\t" + strings.Repeat("x", 100) + "\n",
+			opts:   []Option{WithMaxLineSize(64)},
+			target: ErrLineTooLong,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := readGroups(t, NewParser(strings.NewReader(tc.input), tc.opts...))
+			require.Error(t, err)
+			require.ErrorContains(t, err, "porcelain: line ")
+			if tc.target != nil {
+				require.True(t, errors.Is(err, tc.target), err)
+			}
+		})
+	}
+}
+
+func FuzzParser(f *testing.F) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.porcelain"))
+	require.NoError(f, err)
+
+	for _, name := range files {
+		data, err := os.ReadFile(name)
+		require.NoError(f, err)
+		f.Add(data)
+	}
+	f.Add([]byte(""))
+	f.Add([]byte("d5e9958063725c54e82b2e77427bd0dcbaf43fef 1 1 1\nboundary\nfilename \"a\\tb\"\n\t\n"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		p := NewParser(strings.NewReader(string(data)), WithMaxLineSize(1024), WithMaxGroupLines(2))
+		groups, _ := readGroups(t, p)
+
+		for _, g := range groups {
+			if g.Commit == nil || !isHash(g.Commit.Hash) {
+				t.Fatalf("group without commit: %+v", g)
+			}
+			if g.Filename == "" {
+				t.Fatalf("group without filename: %+v", g)
+			}
+			if len(g.Lines) == 0 || len(g.Lines) > 2 {
+				t.Fatalf("group of %d lines", len(g.Lines))
+			}
+			if g.OrigLine < 1 || g.FinalLine < 1 {
+				t.Fatalf("group at line %d:%d", g.OrigLine, g.FinalLine)
+			}
+		}
+	})
+}
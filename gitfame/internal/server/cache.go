@@ -0,0 +1,64 @@
+package server
+
+import (
+	"container/list"
+	"sync"
+
+	"gitlab.com/slon/shad-go/gitfame/pkg/gitfame"
+)
+
+// cache is an LRU cache of reports.
+type cache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key    string
+	report *gitfame.Report
+}
+
+func newCache(size int) *cache {
+	return &cache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *cache) get(key string) (*gitfame.Report, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	c.order.MoveToFront(e)
+	return e.Value.(*cacheEntry).report, true
+}
+
+func (c *cache) add(key string, report *gitfame.Report) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.size <= 0 {
+		return
+	}
+
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*cacheEntry).report = report
+		c.order.MoveToFront(e)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, report: report})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
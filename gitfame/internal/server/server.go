@@ -0,0 +1,411 @@
+// Package server serves gitfame reports of local repositories over HTTP.
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/slon/shad-go/gitfame/internal/git"
+	"gitlab.com/slon/shad-go/gitfame/pkg/gitfame"
+)
+
+var contentTypes = map[string]string{
+	gitfame.FormatTabular:   "text/plain; charset=utf-8",
+	gitfame.FormatCSV:       "text/csv; charset=utf-8",
+	gitfame.FormatJSON:      "application/json",
+	gitfame.FormatJSONLines: "application/x-ndjson",
+	gitfame.FormatMatrixCSV: "text/csv; charset=utf-8",
+}
+
+// Server serves reports of repositories located in subdirectories of a single directory.
+//
+//	GET /api/v1/repos/{name}/fame?revision=&format=&languages=...
+//
+// Query parameters mirror the flags of the gitfame command, format defaults to json.
+// Reports are cached per resolved commit, and concurrent requests for the same
+// report are calculated once. A calculation is cancelled when all the requests
+// waiting for it are gone, when it exceeds the report timeout or when the server is closed.
+type Server struct {
+	reposDir string
+	mux      *http.ServeMux
+	cache    *cache
+
+	// ctx is the parent of the calculations, cancelled by Close.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	reportTimeout time.Duration
+
+	mu      sync.Mutex
+	flights map[string]*flight
+
+	// run calculates reports, replaced in tests.
+	run func(ctx context.Context, opts gitfame.Options) (*gitfame.Report, error)
+}
+
+// flight is a calculation of a report shared by the waiting requests.
+type flight struct {
+	cancel  context.CancelFunc
+	waiters int
+
+	// done is closed when report and err are set.
+	done   chan struct{}
+	report *gitfame.Report
+	err    error
+}
+
+// Option configures the Server.
+type Option func(*Server)
+
+// WithReportTimeout limits the time of the calculation of every report, unlimited if zero.
+func WithReportTimeout(timeout time.Duration) Option {
+	return func(s *Server) {
+		s.reportTimeout = timeout
+	}
+}
+
+// New creates a server for the repositories in reposDir.
+// The cache holds at most cacheSize reports.
+func New(reposDir string, cacheSize int, opts ...Option) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		reposDir: reposDir,
+		mux:      http.NewServeMux(),
+		cache:    newCache(cacheSize),
+		ctx:      ctx,
+		cancel:   cancel,
+		flights:  make(map[string]*flight),
+		run:      gitfame.Run,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.mux.HandleFunc("GET /api/v1/repos/{name}/fame", s.handleFame)
+	return s
+}
+
+// Close cancels the calculations in progress, the requests waiting for them fail.
+// Reports requested after Close are not calculated.
+func (s *Server) Close() {
+	s.cancel()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) handleFame(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("repository %q not found", name))
+		return
+	}
+
+	dir := filepath.Join(s.reposDir, name)
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		writeError(w, http.StatusNotFound, fmt.Errorf("repository %q not found", name))
+		return
+	}
+
+	query := r.URL.Query()
+
+	formatName := query.Get("format")
+	if formatName == "" {
+		formatName = gitfame.FormatJSON
+	}
+	var writerOpts []gitfame.WriterOption
+	metadata := false
+	if v := query.Get("metadata"); v != "" {
+		var err error
+		if metadata, err = strconv.ParseBool(v); err != nil {
+			writeError(w, http.StatusBadRequest, &gitfame.OptionError{Option: "metadata", Err: fmt.Errorf("malformed value %q", v)})
+			return
+		}
+		if metadata {
+			writerOpts = append(writerOpts, gitfame.WithMetadata())
+		}
+	}
+	columns := splitList(query["columns"])
+	if len(columns) > 0 {
+		writerOpts = append(writerOpts, gitfame.WithColumns(columns...))
+	}
+
+	writer, err := gitfame.NewWriter(formatName, writerOpts...)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	opts, err := parseOptions(query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	opts.Repository = dir
+	opts.Classify = len(columns) > 0
+
+	sha, err := git.Open(dir).ResolveRevision(r.Context(), opts.Revision)
+	if errors.Is(err, git.ErrUnknownRevision) || errors.Is(err, git.ErrRepositoryNotFound) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	opts.Revision = sha
+
+	key := cacheKey(name, &opts)
+	etag := `"` + sha + "-" + shortHash(key+"\x00"+formatName+"\x00"+strconv.FormatBool(metadata)+"\x00"+strings.Join(columns, ",")) + `"`
+	w.Header().Set("ETag", etag)
+
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	report, err := s.report(r.Context(), key, opts)
+	if errors.Is(err, gitfame.ErrInvalidOptions) {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		writeError(w, http.StatusGatewayTimeout, fmt.Errorf("report timed out after %s", s.reportTimeout))
+		return
+	} else if errors.Is(err, context.Canceled) {
+		writeError(w, http.StatusServiceUnavailable, errors.New("server is shutting down"))
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	var body bytes.Buffer
+	if err := writer.Write(&body, report); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypes[formatName])
+	_, _ = w.Write(body.Bytes())
+}
+
+// report returns the cached report or calculates it,
+// sharing the calculation between concurrent callers.
+//
+// report returns ctx.Err() if ctx is done first; the calculation is cancelled
+// if no other callers wait for it.
+func (s *Server) report(ctx context.Context, key string, opts gitfame.Options) (*gitfame.Report, error) {
+	if report, ok := s.cache.get(key); ok {
+		return report, nil
+	}
+
+	s.mu.Lock()
+	f, ok := s.flights[key]
+	if !ok {
+		// The report may have been calculated since the cache was checked.
+		if report, ok := s.cache.get(key); ok {
+			s.mu.Unlock()
+			return report, nil
+		}
+		f = s.start(key, opts)
+	}
+	f.waiters++
+	s.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.report, f.err
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f.waiters--; f.waiters == 0 {
+		f.cancel()
+		// The following callers start over instead of waiting for the cancelled calculation.
+		if s.flights[key] == f {
+			delete(s.flights, key)
+		}
+	}
+	return nil, ctx.Err()
+}
+
+// start calculates the report in the background, s.mu must be held.
+func (s *Server) start(key string, opts gitfame.Options) *flight {
+	// The calculation is shared, so it must not depend on any single request.
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if s.reportTimeout > 0 {
+		ctx, cancel = context.WithTimeout(s.ctx, s.reportTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(s.ctx)
+	}
+
+	f := &flight{cancel: cancel, done: make(chan struct{})}
+	s.flights[key] = f
+
+	go func() {
+		defer cancel()
+
+		report, err := s.run(ctx, opts)
+		if err != nil && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		if err == nil {
+			// The state stays cached, the triples of matrix-csv are built from it.
+			s.cache.add(key, report)
+		}
+
+		s.mu.Lock()
+		if s.flights[key] == f {
+			delete(s.flights, key)
+		}
+		s.mu.Unlock()
+
+		f.report, f.err = report, err
+		close(f.done)
+	}()
+	return f
+}
+
+// parseOptions converts query parameters to options.
+// List parameters accept both comma-separated and repeated values.
+func parseOptions(query url.Values) (gitfame.Options, error) {
+	opts := gitfame.Options{
+		Revision:             query.Get("revision"),
+		OrderBy:              query.Get("order-by"),
+		GroupBy:              strings.ToLower(query.Get("group-by")),
+		PatternSyntax:        query.Get("pattern-syntax"),
+		Extensions:           splitList(query["extensions"]),
+		Languages:            splitList(query["languages"]),
+		Exclude:              splitList(query["exclude"]),
+		RestrictTo:           splitList(query["restrict-to"]),
+		Paths:                query["path"],
+		ExcludeCommitMessage: query.Get("exclude-commit-message"),
+		ExcludeMode:          query.Get("exclude-mode"),
+		CommitsFrom:          query.Get("commits-from"),
+		Count:                query.Get("count"),
+	}
+
+	for _, p := range []struct {
+		name  string
+		value *bool
+	}{
+		{"use-committer", &opts.UseCommitter},
+		{"skip-binary", &opts.SkipBinary},
+		{"strip-path", &opts.StripPath},
+	} {
+		if v := query.Get(p.name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return opts, &gitfame.OptionError{Option: p.name, Err: fmt.Errorf("malformed value %q", v)}
+			}
+			*p.value = b
+		}
+	}
+
+	if v := query.Get("max-file-size"); v != "" {
+		n, err := gitfame.ParseSize(v)
+		if err != nil {
+			return opts, &gitfame.OptionError{Option: "max-file-size", Err: err}
+		}
+		opts.MaxFileSize = n
+	}
+
+	for _, p := range []struct {
+		name  string
+		value *int
+	}{
+		{"min-lines", &opts.MinLines},
+		{"top", &opts.Top},
+	} {
+		if v := query.Get(p.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return opts, &gitfame.OptionError{Option: p.name, Err: fmt.Errorf("malformed value %q", v)}
+			}
+			*p.value = n
+		}
+	}
+
+	if opts.Revision == "" {
+		opts.Revision = "HEAD"
+	}
+
+	return opts, nil
+}
+
+func splitList(values []string) []string {
+	var items []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// cacheKey identifies the report of the repository calculated with the options.
+// opts.Revision must be a resolved commit hash.
+func cacheKey(name string, opts *gitfame.Options) string {
+	key, _ := json.Marshal([]interface{}{
+		name,
+		opts.Revision,
+		opts.OrderBy,
+		opts.UseCommitter,
+		opts.GroupBy,
+		opts.PatternSyntax,
+		opts.Extensions,
+		opts.Languages,
+		opts.Exclude,
+		opts.RestrictTo,
+		opts.Paths,
+		opts.StripPath,
+		opts.MaxFileSize,
+		opts.SkipBinary,
+		opts.ExcludeCommitMessage,
+		opts.ExcludeMode,
+		opts.CommitsFrom,
+		opts.Count,
+		opts.Classify,
+		opts.MinLines,
+		opts.Top,
+	})
+	return string(key)
+}
+
+func shortHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:8])
+}
+
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Del("ETag")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
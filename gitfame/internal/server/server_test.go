@@ -0,0 +1,290 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/gitfame/pkg/gitfame"
+)
+
+const bundlesDir = "../../test/integration/testdata/bundles"
+
+// newTestServer serves clones of the simple and breaker bundles.
+func newTestServer(t *testing.T) (*Server, *httptest.Server) {
+	t.Helper()
+
+	reposDir := t.TempDir()
+	for _, name := range []string{"simple", "breaker"} {
+		cmd := exec.Command("git", "clone", filepath.Join(bundlesDir, name+".bundle"), filepath.Join(reposDir, name))
+		require.NoError(t, cmd.Run())
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(reposDir, "file"), nil, 0o644))
+
+	s := New(reposDir, 16)
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+
+	return s, ts
+}
+
+func get(t *testing.T, url string, header http.Header) (*http.Response, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	return resp, string(body)
+}
+
+func TestFame(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	resp, body := get(t, ts.URL+"/api/v1/repos/simple/fame?revision=v1.0", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	require.JSONEq(t, `[
+		{"name":"Rob Pike","lines":12,"commits":3,"files":3},
+		{"name":"Brad Fitzpatrick","lines":1,"commits":1,"files":1}
+	]`, body)
+
+	resp, body = get(t, ts.URL+"/api/v1/repos/simple/fame?revision=v1.0&format=csv&use-committer=true", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "Name,Lines,Commits,Files\nRob Pike,7,2,2\nRandall77,5,1,1\nBrad Fitzpatrick,1,1,1\n", body)
+
+	resp, body = get(t, ts.URL+"/api/v1/repos/simple/fame?revision=v1.0&format=csv&languages=markdown&extensions=.md,.txt&extensions=.go", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "Name,Lines,Commits,Files\nRob Pike,5,2,2\n", body)
+
+	resp, body = get(t, ts.URL+"/api/v1/repos/breaker/fame?revision=d5e9958063725c54e82b2e77427bd0dcbaf43fef&format=json-lines", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+	require.JSONEq(t, `{"name":"Brad Fitzpatrick","lines":4,"commits":1,"files":1}`, body)
+}
+
+func TestFameErrors(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	for _, tc := range []struct {
+		path string
+		code int
+	}{
+		{path: "/api/v1/repos/missing/fame", code: http.StatusNotFound},
+		{path: "/api/v1/repos/file/fame", code: http.StatusNotFound},
+		{path: "/api/v1/repos/..%2F..%2Fetc/fame", code: http.StatusNotFound},
+		{path: "/api/v1/repos/simple/fame?revision=H3AD", code: http.StatusNotFound},
+		{path: "/api/v1/repos/simple/fame?format=yson", code: http.StatusBadRequest},
+		{path: "/api/v1/repos/simple/fame?order-by=time", code: http.StatusBadRequest},
+		{path: "/api/v1/repos/simple/fame?use-committer=maybe", code: http.StatusBadRequest},
+		{path: "/api/v1/repos/simple/fame?pattern-syntax=regexp&exclude=.*", code: http.StatusBadRequest},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			resp, body := get(t, ts.URL+tc.path, nil)
+			require.Equal(t, tc.code, resp.StatusCode, body)
+			require.Empty(t, resp.Header.Get("ETag"))
+			require.Contains(t, body, `"error"`)
+		})
+	}
+}
+
+func TestFameETag(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	url := ts.URL + "/api/v1/repos/simple/fame?revision=v1.0"
+
+	resp, _ := get(t, url, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	etag := resp.Header.Get("ETag")
+	require.NotEmpty(t, etag)
+
+	// The tag points to the same commit, so the report is the same.
+	resp, _ = get(t, ts.URL+"/api/v1/repos/simple/fame?revision=v1.0%5E%7Bcommit%7D", http.Header{"If-None-Match": {etag}})
+	require.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	resp, _ = get(t, url+"&format=csv", http.Header{"If-None-Match": {etag}})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NotEqual(t, etag, resp.Header.Get("ETag"))
+
+	resp, _ = get(t, ts.URL+"/api/v1/repos/simple/fame?revision=HEAD%5E1", http.Header{"If-None-Match": {etag}})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NotEqual(t, etag, resp.Header.Get("ETag"))
+}
+
+func TestFameCoalescesAndCaches(t *testing.T) {
+	s, ts := newTestServer(t)
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	s.run = func(ctx context.Context, opts gitfame.Options) (*gitfame.Report, error) {
+		calls.Add(1)
+		<-release
+		return gitfame.Run(ctx, opts)
+	}
+
+	const requests = 8
+	url := ts.URL + "/api/v1/repos/simple/fame?revision=v1.0&format=csv"
+
+	var wg sync.WaitGroup
+	bodies := make([]string, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, bodies[i] = get(t, url, nil)
+		}(i)
+	}
+
+	// Let all requests reach the calculation before releasing it.
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, 10*time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for _, body := range bodies {
+		require.Equal(t, bodies[0], body)
+	}
+
+	_, body := get(t, url, nil)
+	require.Equal(t, bodies[0], body)
+	require.Equal(t, int32(1), calls.Load())
+}
+
+func TestFameTimeout(t *testing.T) {
+	s, ts := newTestServer(t)
+	s.reportTimeout = 10 * time.Millisecond
+	s.run = func(ctx context.Context, opts gitfame.Options) (*gitfame.Report, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	resp, body := get(t, ts.URL+"/api/v1/repos/simple/fame?revision=v1.0", nil)
+	require.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+	require.Contains(t, body, "timed out")
+}
+
+func TestFameCancelled(t *testing.T) {
+	s, ts := newTestServer(t)
+
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	s.run = func(ctx context.Context, opts gitfame.Options) (*gitfame.Report, error) {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	}
+
+	// The calculation is cancelled when its only client disconnects.
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/api/v1/repos/simple/fame?revision=v1.0", nil)
+	require.NoError(t, err)
+
+	errc := make(chan error, 1)
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+		errc <- err
+	}()
+
+	<-started
+	cancel()
+	require.Error(t, <-errc)
+
+	select {
+	case <-cancelled:
+	case <-time.After(10 * time.Second):
+		t.Fatal("calculation is not cancelled")
+	}
+}
+
+func TestFameClose(t *testing.T) {
+	s, ts := newTestServer(t)
+
+	started := make(chan struct{})
+	s.run = func(ctx context.Context, opts gitfame.Options) (*gitfame.Report, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	go func() {
+		<-started
+		s.Close()
+	}()
+
+	resp, _ := get(t, ts.URL+"/api/v1/repos/simple/fame?revision=v1.0", nil)
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestFameMetadata(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	url := ts.URL + "/api/v1/repos/simple/fame?revision=v1.0&commits-from=log&metadata=true"
+	resp, body := get(t, url, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.JSONEq(t, `{
+		"metadata": {"revision": "f4d5081f2c3f447e54bc5e74ea177f6d486efaac", "commits_from": "log", "count": "all", "authors": 4, "skipped": 0, "partial": false},
+		"authors": [
+			{"name":"Rob Pike","lines":12,"commits":3,"files":3},
+			{"name":"Brad Fitzpatrick","lines":1,"commits":1,"files":1},
+			{"name":"Rober Griesemer","lines":0,"commits":1,"files":0},
+			{"name":"Russ Cox","lines":0,"commits":1,"files":0}
+		]
+	}`, body)
+
+	// The same report without metadata is a different representation.
+	resp2, _ := get(t, ts.URL+"/api/v1/repos/simple/fame?revision=v1.0&commits-from=log", nil)
+	require.NotEqual(t, resp.Header.Get("ETag"), resp2.Header.Get("ETag"))
+}
+
+func TestFameMatrixCSV(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	url := ts.URL + "/api/v1/repos/simple/fame?revision=v1.0"
+	for range 2 {
+		// The second request is served from the cache the first one filled.
+		resp, body := get(t, url+"&format=matrix-csv", nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "text/csv; charset=utf-8", resp.Header.Get("Content-Type"))
+		require.Equal(t, `File,Name,Lines,Commits
+doc.go,Brad Fitzpatrick,1,9db7731746bfc069375e397f0d56c0c11396b421
+features.md,Rob Pike,5,f4d5081f2c3f447e54bc5e74ea177f6d486efaac
+hello.go,Rob Pike,7,00a6a716ebbf3841b57003dd470b8c31fab4be2b 138c45422c22ec37a4ce1feb47ba3c68d5079b2a
+readme.md,Rob Pike,0,138c45422c22ec37a4ce1feb47ba3c68d5079b2a
+`, body)
+	}
+}
+
+func TestFameColumns(t *testing.T) {
+	_, ts := newTestServer(t)
+
+	_, body := get(t, ts.URL+"/api/v1/repos/simple/fame?revision=v1.0&count=code&columns=comments,blank", nil)
+	require.JSONEq(t, `[
+		{"name":"Rob Pike","lines":8,"commits":3,"files":3,"comments":0,"blank":4},
+		{"name":"Brad Fitzpatrick","lines":1,"commits":1,"files":1,"comments":0,"blank":0}
+	]`, body)
+
+	resp, _ := get(t, ts.URL+"/api/v1/repos/simple/fame?columns=lines", nil)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -0,0 +1,264 @@
+// Package stats aggregates blame results into per-author statistics.
+package stats
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"gitlab.com/slon/shad-go/gitfame/internal/git"
+)
+
+// Author holds statistics of a single author.
+type Author struct {
+	Name    string
+	Lines   int
+	Commits int
+	Files   int
+
+	// Code, Comments and Blank break Lines down by kind.
+	Code     int
+	Comments int
+	Blank    int
+}
+
+// Lines holds numbers of lines of each kind.
+type Lines struct {
+	Code     int
+	Comments int
+	Blank    int
+}
+
+// Total returns the number of lines of all kinds.
+func (l Lines) Total() int {
+	return l.Code + l.Comments + l.Blank
+}
+
+func (l *Lines) add(other Lines) {
+	l.Code += other.Code
+	l.Comments += other.Comments
+	l.Blank += other.Blank
+}
+
+// Collector accumulates blame results of files.
+//
+// Collector is not safe for concurrent use.
+type Collector struct {
+	useCommitter   bool
+	commitsFromLog bool
+	authors        map[string]*author
+}
+
+type author struct {
+	lines   Lines
+	commits map[string]struct{}
+	files   map[string]struct{}
+}
+
+// NewCollector returns an empty Collector.
+//
+// If useCommitter is set, lines are attributed to committers instead of authors.
+// If commitsFromLog is set, commits are counted from AddLogCommit only,
+// otherwise they are the commits of the accounted lines.
+func NewCollector(useCommitter, commitsFromLog bool) *Collector {
+	return &Collector{
+		useCommitter:   useCommitter,
+		commitsFromLog: commitsFromLog,
+		authors:        make(map[string]*author),
+	}
+}
+
+func (c *Collector) author(commit *git.Commit) *author {
+	name := commit.Author
+	if c.useCommitter {
+		name = commit.Committer
+	}
+
+	a, ok := c.authors[name]
+	if !ok {
+		a = &author{
+			commits: make(map[string]struct{}),
+			files:   make(map[string]struct{}),
+		}
+		c.authors[name] = a
+	}
+	return a
+}
+
+// AddLines accounts lines of the file last modified by the commit.
+func (c *Collector) AddLines(path string, commit *git.Commit, lines Lines) {
+	a := c.author(commit)
+	a.lines.add(lines)
+	if !c.commitsFromLog {
+		a.commits[commit.Hash] = struct{}{}
+	}
+	a.files[path] = struct{}{}
+}
+
+// AddLogCommit accounts a commit from the history if commits are counted from the log.
+func (c *Collector) AddLogCommit(commit *git.Commit) {
+	if c.commitsFromLog {
+		c.author(commit).commits[commit.Hash] = struct{}{}
+	}
+}
+
+// AddEmptyFile accounts an empty file last modified by the commit.
+func (c *Collector) AddEmptyFile(path string, commit *git.Commit) {
+	c.AddLines(path, commit, Lines{})
+}
+
+// Authors returns statistics of all accounted authors in unspecified order.
+func (c *Collector) Authors() []Author {
+	authors := make([]Author, 0, len(c.authors))
+	for name, a := range c.authors {
+		authors = append(authors, Author{
+			Name:     name,
+			Lines:    a.lines.Total(),
+			Commits:  len(a.commits),
+			Files:    len(a.files),
+			Code:     a.lines.Code,
+			Comments: a.lines.Comments,
+			Blank:    a.lines.Blank,
+		})
+	}
+	return authors
+}
+
+// Merge returns statistics of the authors merged under the name.
+// Commits and files shared by several authors are counted once.
+func (c *Collector) Merge(name string, names []string) Author {
+	var lines Lines
+	commits := make(map[string]struct{})
+	files := make(map[string]struct{})
+
+	for _, n := range names {
+		a, ok := c.authors[n]
+		if !ok {
+			continue
+		}
+
+		lines.add(a.lines)
+		for hash := range a.commits {
+			commits[hash] = struct{}{}
+		}
+		for path := range a.files {
+			files[path] = struct{}{}
+		}
+	}
+
+	return Author{
+		Name:     name,
+		Lines:    lines.Total(),
+		Commits:  len(commits),
+		Files:    len(files),
+		Code:     lines.Code,
+		Comments: lines.Comments,
+		Blank:    lines.Blank,
+	}
+}
+
+// Order keys.
+const (
+	OrderByLines   = "lines"
+	OrderByCommits = "commits"
+	OrderByFiles   = "files"
+	OrderByName    = "name"
+)
+
+// defaultOrder is the order of the numeric keys not listed explicitly.
+var defaultOrder = []string{OrderByLines, OrderByCommits, OrderByFiles}
+
+type sortKey struct {
+	name      string
+	ascending bool
+}
+
+func (k sortKey) compare(a, b *Author) int {
+	var c int
+	switch k.name {
+	case OrderByLines:
+		c = cmp.Compare(a.Lines, b.Lines)
+	case OrderByCommits:
+		c = cmp.Compare(a.Commits, b.Commits)
+	case OrderByFiles:
+		c = cmp.Compare(a.Files, b.Files)
+	case OrderByName:
+		c = strings.Compare(a.Name, b.Name)
+	}
+
+	if !k.ascending {
+		c = -c
+	}
+	return c
+}
+
+// parseOrder parses a comma-separated list of keys, each optionally prefixed
+// with + for the ascending or - for the descending direction.
+//
+// Numeric keys are descending and the name is ascending by default.
+// Numeric keys missing from the list follow the listed ones in the (lines, commits, files)
+// order, ties are broken by the name if it is not listed.
+func parseOrder(orderBy string) ([]sortKey, error) {
+	var keys []sortKey
+	listed := make(map[string]bool)
+
+	for _, item := range strings.Split(orderBy, ",") {
+		key := sortKey{name: strings.TrimSpace(item)}
+
+		switch {
+		case strings.HasPrefix(key.name, "+"):
+			key.name, key.ascending = key.name[1:], true
+		case strings.HasPrefix(key.name, "-"):
+			key.name = key.name[1:]
+		default:
+			key.ascending = key.name == OrderByName
+		}
+
+		switch key.name {
+		case OrderByLines, OrderByCommits, OrderByFiles, OrderByName:
+		default:
+			return nil, fmt.Errorf("unknown order key %q", item)
+		}
+
+		if listed[key.name] {
+			return nil, fmt.Errorf("duplicate order key %q", key.name)
+		}
+		listed[key.name] = true
+
+		keys = append(keys, key)
+	}
+
+	for _, name := range defaultOrder {
+		if !listed[name] {
+			keys = append(keys, sortKey{name: name})
+		}
+	}
+	if !listed[OrderByName] {
+		keys = append(keys, sortKey{name: OrderByName, ascending: true})
+	}
+
+	return keys, nil
+}
+
+// Sort sorts authors according to orderBy, see parseOrder for the syntax.
+//
+// A single numeric key moves it to the first place of the default descending
+// (lines, commits, files) order, ties are broken by the lexicographically smaller name.
+func Sort(authors []Author, orderBy string) error {
+	keys, err := parseOrder(orderBy)
+	if err != nil {
+		return err
+	}
+
+	slices.SortFunc(authors, func(a, b Author) int {
+		for _, k := range keys {
+			if c := k.compare(&a, &b); c != 0 {
+				return c
+			}
+		}
+		return 0
+	})
+
+	return nil
+}
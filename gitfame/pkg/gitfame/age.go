@@ -0,0 +1,306 @@
+package gitfame
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/slon/shad-go/gitfame/internal/format"
+)
+
+// Units of Age.
+const (
+	AgeDays   = "d"
+	AgeWeeks  = "w"
+	AgeMonths = "m"
+	AgeYears  = "y"
+)
+
+// Age is an age of code in calendar units, e.g. 6 months.
+type Age struct {
+	N    int
+	Unit string
+}
+
+func (a Age) String() string {
+	return strconv.Itoa(a.N) + a.Unit
+}
+
+// before returns the time the age before t.
+func (a Age) before(t time.Time) time.Time {
+	switch a.Unit {
+	case AgeDays:
+		return t.AddDate(0, 0, -a.N)
+	case AgeWeeks:
+		return t.AddDate(0, 0, -7*a.N)
+	case AgeMonths:
+		return t.AddDate(0, -a.N, 0)
+	default:
+		return t.AddDate(-a.N, 0, 0)
+	}
+}
+
+// in returns the age in the unit if it is a whole number of them.
+func (a Age) in(unit string) (Age, bool) {
+	switch {
+	case a.Unit == unit:
+		return a, true
+	case a.Unit == AgeWeeks && unit == AgeDays:
+		return Age{N: 7 * a.N, Unit: unit}, true
+	case a.Unit == AgeDays && unit == AgeWeeks && a.N%7 == 0:
+		return Age{N: a.N / 7, Unit: unit}, true
+	case a.Unit == AgeYears && unit == AgeMonths:
+		return Age{N: 12 * a.N, Unit: unit}, true
+	case a.Unit == AgeMonths && unit == AgeYears && a.N%12 == 0:
+		return Age{N: a.N / 12, Unit: unit}, true
+	}
+	return Age{}, false
+}
+
+// DefaultAgeBuckets are the bounds of the <1m, 1-6m, 6-12m, 1-2y and >2y buckets.
+var DefaultAgeBuckets = []Age{{1, AgeMonths}, {6, AgeMonths}, {12, AgeMonths}, {2, AgeYears}}
+
+// ParseAgeBuckets parses a comma-separated list of ascending bounds of age buckets,
+// each a number followed by d for days, w for weeks, m for months or y for years, e.g. "1m,6m,12m,2y".
+func ParseAgeBuckets(s string) ([]Age, error) {
+	var bounds []Age
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			return nil, fmt.Errorf("malformed age %q", item)
+		}
+
+		unit := item[len(item)-1:]
+		switch unit {
+		case AgeDays, AgeWeeks, AgeMonths, AgeYears:
+		default:
+			return nil, fmt.Errorf("malformed age %q", item)
+		}
+
+		n, err := strconv.Atoi(item[:len(item)-1])
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("malformed age %q", item)
+		}
+
+		bounds = append(bounds, Age{N: n, Unit: unit})
+	}
+
+	if err := validateAgeBuckets(bounds); err != nil {
+		return nil, err
+	}
+	return bounds, nil
+}
+
+func validateAgeBuckets(bounds []Age) error {
+	if len(bounds) == 0 {
+		return fmt.Errorf("no age buckets")
+	}
+
+	// Months are compared in the longest of them.
+	t := time.Date(2001, time.January, 31, 0, 0, 0, 0, time.UTC)
+	for i := 1; i < len(bounds); i++ {
+		if !bounds[i].before(t).Before(bounds[i-1].before(t)) {
+			return fmt.Errorf("age %s is not greater than %s", bounds[i], bounds[i-1])
+		}
+	}
+	return nil
+}
+
+// ageLabels returns the labels of the buckets with the bounds, e.g. "<1m", "1-6m" and ">2y".
+func ageLabels(bounds []Age) []string {
+	labels := []string{"<" + bounds[0].String()}
+	for i := 1; i < len(bounds); i++ {
+		lo, hi := bounds[i-1], bounds[i]
+		if l, ok := lo.in(hi.Unit); ok {
+			labels = append(labels, fmt.Sprintf("%d-%s", l.N, hi))
+		} else if h, ok := hi.in(lo.Unit); ok {
+			labels = append(labels, fmt.Sprintf("%d-%s", lo.N, h))
+		} else {
+			labels = append(labels, fmt.Sprintf("%s-%s", lo, hi))
+		}
+	}
+	return append(labels, ">"+bounds[len(bounds)-1].String())
+}
+
+// AgeOptions configure RunAge.
+type AgeOptions struct {
+	// Buckets are the ascending upper bounds of the age buckets, DefaultAgeBuckets by default.
+	// Lines older than the last bound fall into the extra last bucket.
+	Buckets []Age
+	// Now is the time the ages are measured relative to, the commit time of the revision by default.
+	Now time.Time
+}
+
+// AgeReport is the result of RunAge.
+type AgeReport struct {
+	*Report
+	// Time is the time the ages are measured relative to.
+	Time time.Time
+	// Buckets are the labels of the buckets, e.g. "<1m", "1-6m" and ">2y".
+	Buckets []string
+	// Ages break the lines of Report.Authors down by bucket, in the same order.
+	Ages []AuthorAges
+}
+
+// AuthorAges holds the numbers of lines of an author by age.
+type AuthorAges struct {
+	Name  string
+	Lines int
+	// Buckets are the numbers of lines in each of AgeReport.Buckets.
+	Buckets []int
+}
+
+// RunAge calculates statistics of the repository and breaks the lines of the authors
+// down by the age of the commits that last modified them.
+//
+// The age is measured by the author time of the commits, or by the committer time with Options.UseCommitter.
+func RunAge(ctx context.Context, opts Options, ageOpts AgeOptions) (*AgeReport, error) {
+	bounds := ageOpts.Buckets
+	if bounds == nil {
+		bounds = DefaultAgeBuckets
+	}
+	if err := validateAgeBuckets(bounds); err != nil {
+		return nil, &OptionError{Option: "age-buckets", Err: err}
+	}
+
+	now := ageOpts.Now
+	if now.IsZero() {
+		// The revision is resolved once for the time and the report to agree.
+		var err error
+		if opts.Revision, now, err = revisionTime(ctx, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	report, err := Run(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ages := &AgeReport{Report: report, Time: now, Buckets: ageLabels(bounds)}
+	rows := make(map[string]int, len(report.Authors)+len(report.Folded))
+	for i, a := range report.Authors {
+		rows[a.Name] = i
+		ages.Ages = append(ages.Ages, AuthorAges{Name: a.Name, Lines: a.Lines, Buckets: make([]int, len(bounds)+1)})
+	}
+	for _, name := range report.Folded {
+		rows[name] = rows[Others]
+	}
+
+	// Bucket i holds the lines modified after limits[i] but not after limits[i-1].
+	limits := make([]time.Time, len(bounds))
+	for i, b := range bounds {
+		limits[i] = b.before(now)
+	}
+
+	for _, f := range report.State.Files {
+		for hash := range f.Lines {
+			commit := report.State.Commits[hash]
+			name, t := commit.Author, commit.AuthorTime
+			if opts.UseCommitter {
+				name, t = commit.Committer, commit.CommitterTime
+			}
+
+			row, ok := rows[name]
+			if !ok {
+				// The author is dropped by Options.MinLines.
+				continue
+			}
+
+			bucket := len(bounds)
+			for i, limit := range limits {
+				if time.Unix(t, 0).After(limit) {
+					bucket = i
+					break
+				}
+			}
+			ages.Ages[row].Buckets[bucket] += f.counted(hash, opts.Count)
+		}
+	}
+
+	return ages, nil
+}
+
+// revisionTime returns the hash and the commit time of the revision.
+func revisionTime(ctx context.Context, opts Options) (string, time.Time, error) {
+	opts.setDefaults()
+	if err := opts.validate(); err != nil {
+		return "", time.Time{}, err
+	}
+
+	backend, _, err := opts.open()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	hash, err := backend.ResolveRevision(ctx, opts.Revision)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	c, err := backend.ReadCommit(ctx, hash)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return hash, c.CommitterTime, nil
+}
+
+// ageRow encodes the buckets as a json object with the fields in the order of the buckets.
+type ageRow struct {
+	AuthorAges
+	labels []string
+}
+
+func (r ageRow) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(`{"name":`)
+	name, err := json.Marshal(r.Name)
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(name)
+	fmt.Fprintf(&buf, `,"lines":%d,"buckets":{`, r.Lines)
+	for i, label := range r.labels {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(label)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buf, "%s:%d", key, r.Buckets[i])
+	}
+	buf.WriteString("}}")
+	return buf.Bytes(), nil
+}
+
+// WriteAges renders the report in the built-in output format:
+// a row of the name, the lines and the lines of each bucket per author.
+func WriteAges(w io.Writer, name string, r *AgeReport) error {
+	if err := format.Validate(name); err != nil {
+		return &OptionError{Option: "format", Err: err}
+	}
+
+	rows := make([]ageRow, 0, len(r.Ages))
+	for _, a := range r.Ages {
+		rows = append(rows, ageRow{AuthorAges: a, labels: r.Buckets})
+	}
+
+	t := &format.Table[ageRow]{
+		Header: append([]string{"Name", "Lines"}, r.Buckets...),
+		Items:  rows,
+		Record: func(row *ageRow) []string {
+			record := []string{row.Name, strconv.Itoa(row.Lines)}
+			for _, n := range row.Buckets {
+				record = append(record, strconv.Itoa(n))
+			}
+			return record
+		},
+	}
+	return t.Write(w, name)
+}
@@ -0,0 +1,112 @@
+package gitfame
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAgeBuckets(t *testing.T) {
+	bounds, err := ParseAgeBuckets("1m, 6m,12m,2y")
+	require.NoError(t, err)
+	require.Equal(t, DefaultAgeBuckets, bounds)
+	require.Equal(t, []string{"<1m", "1-6m", "6-12m", "1-2y", ">2y"}, ageLabels(bounds))
+
+	bounds, err = ParseAgeBuckets("1w,30d,1m,1y")
+	require.NoError(t, err)
+	require.Equal(t, []string{"<1w", "7-30d", "30d-1m", "1-12m", ">1y"}, ageLabels(bounds))
+
+	for _, s := range []string{"", "1m,", "m", "0d", "-1w", "1h", "1.5y", "6m,1m", "12m,1y", "1m,31d"} {
+		_, err := ParseAgeBuckets(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestReplayAge(t *testing.T) {
+	const tabby = "My\tname\tis\tTabby"
+	const odd = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUV\tWXYZ!\"#$%&'()*+,-./:;=?@[\\]^_`{|}~"
+
+	// The readme is the only file added more than a day before the time.
+	day := time.Unix(1614525171, 0).AddDate(0, 0, 1).Add(time.Minute)
+
+	for _, tc := range []struct {
+		name    string
+		opts    Options
+		ageOpts AgeOptions
+		buckets []string
+		ages    []AuthorAges
+	}{
+		{
+			name:    "revision time",
+			opts:    Options{Revision: "HEAD"},
+			buckets: []string{"<1m", "1-6m", "6-12m", "1-2y", ">2y"},
+			ages: []AuthorAges{
+				{Name: tabby, Lines: 7, Buckets: []int{7, 0, 0, 0, 0}},
+				{Name: "Brad Fitzpatrick", Lines: 4, Buckets: []int{4, 0, 0, 0, 0}},
+				{Name: odd, Lines: 0, Buckets: []int{0, 0, 0, 0, 0}},
+			},
+		},
+		{
+			name:    "now",
+			opts:    Options{Revision: "HEAD"},
+			ageOpts: AgeOptions{Buckets: []Age{{1, AgeDays}, {1, AgeWeeks}}, Now: day},
+			buckets: []string{"<1d", "1-7d", ">1w"},
+			ages: []AuthorAges{
+				{Name: tabby, Lines: 7, Buckets: []int{7, 0, 0}},
+				{Name: "Brad Fitzpatrick", Lines: 4, Buckets: []int{0, 4, 0}},
+				{Name: odd, Lines: 0, Buckets: []int{0, 0, 0}},
+			},
+		},
+		{
+			name:    "top",
+			opts:    Options{Revision: "HEAD", Top: 1},
+			ageOpts: AgeOptions{Buckets: []Age{{1, AgeDays}}, Now: day},
+			buckets: []string{"<1d", ">1d"},
+			ages: []AuthorAges{
+				{Name: tabby, Lines: 7, Buckets: []int{7, 0}},
+				{Name: Others, Lines: 4, Buckets: []int{0, 4}},
+			},
+		},
+		{
+			name:    "min lines",
+			opts:    Options{Revision: "HEAD", MinLines: 5},
+			ageOpts: AgeOptions{Buckets: []Age{{1, AgeDays}}, Now: day},
+			buckets: []string{"<1d", ">1d"},
+			ages:    []AuthorAges{{Name: tabby, Lines: 7, Buckets: []int{7, 0}}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.opts.backend = replay(t, "breaker.bundle", tc.opts.Revision)
+
+			report, err := RunAge(context.Background(), tc.opts, tc.ageOpts)
+			require.NoError(t, err)
+			require.Equal(t, tc.buckets, report.Buckets)
+			require.Equal(t, tc.ages, report.Ages)
+		})
+	}
+}
+
+func TestWriteAges(t *testing.T) {
+	report, err := RunAge(context.Background(), Options{Revision: "v1.0", backend: replay(t, "simple.bundle", "v1.0")},
+		AgeOptions{Buckets: []Age{{1, AgeYears}}})
+	require.NoError(t, err)
+	require.True(t, report.Time.Equal(time.Unix(1614524047, 0)), "the commit time of v1.0")
+
+	for format, expected := range map[string]string{
+		FormatCSV:       "Name,Lines,<1y,>1y\nRob Pike,12,12,0\nBrad Fitzpatrick,1,1,0\n",
+		FormatJSONLines: "{\"name\":\"Rob Pike\",\"lines\":12,\"buckets\":{\"\\u003c1y\":12,\"\\u003e1y\":0}}\n{\"name\":\"Brad Fitzpatrick\",\"lines\":1,\"buckets\":{\"\\u003c1y\":1,\"\\u003e1y\":0}}\n",
+	} {
+		var out bytes.Buffer
+		require.NoError(t, WriteAges(&out, format, report))
+		require.Equal(t, expected, out.String(), format)
+	}
+
+	_, err = RunAge(context.Background(), Options{Revision: "v1.0", backend: replay(t, "simple.bundle", "v1.0")},
+		AgeOptions{Buckets: []Age{{1, AgeYears}, {6, AgeMonths}}})
+	var optionErr *OptionError
+	require.ErrorAs(t, err, &optionErr)
+	require.Equal(t, "age-buckets", optionErr.Option)
+}
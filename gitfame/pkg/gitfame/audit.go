@@ -0,0 +1,307 @@
+package gitfame
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gitlab.com/slon/shad-go/gitfame/internal/codeowners"
+	"gitlab.com/slon/shad-go/gitfame/internal/format"
+)
+
+// Kinds of the rows of WriteAudit.
+const (
+	AuditRule    = "rule"
+	AuditUnowned = "unowned"
+)
+
+// AuditOptions configure RunAudit.
+type AuditOptions struct {
+	// Threshold is the least share of the lines of the paths of a rule its owners
+	// hold for the rule not to be stale, DefaultCodeownersThreshold by default.
+	Threshold float64
+	// Handles map the names of the authors to the owners as CodeownersOptions.Handles.
+	// An owner holds the lines of the author whose handle, email or name it is, ignoring case.
+	Handles map[string]string
+	// Codeowners is audited instead of the first of CodeownersLocations in the tree of the revision if set.
+	Codeowners *CodeownersFile
+}
+
+// RuleAudit is the ownership of the paths a rule of CODEOWNERS applies to.
+type RuleAudit struct {
+	CodeownersRule
+	// Files and Lines are the ones the rule is the last matching rule of.
+	Files int
+	Lines int
+	// Share is the share of the Lines held by the owners of the rule.
+	Share float64
+	// Top is the owner of the most Lines, empty if there are no lines.
+	Top string
+	// Teams are the team owners of the rule. Their members are unknown,
+	// so they hold no lines.
+	Teams []string
+	// Stale is set if the owners hold less than the threshold share of the lines.
+	// Rules without lines or with team owners only are never stale.
+	Stale bool
+}
+
+// UnownedPath is a file or a directory, with a trailing slash, whose files match no rule
+// or rules without owners.
+type UnownedPath struct {
+	Path  string
+	Files int
+	Lines int
+	// Top is the owner of the most Lines, empty if there are no lines.
+	Top string
+}
+
+// AuditReport is the result of RunAudit.
+type AuditReport struct {
+	*Report
+	// Source describes where CODEOWNERS was loaded from.
+	Source    string
+	Threshold float64
+	// Rules are in the order of CODEOWNERS.
+	Rules []RuleAudit
+	// Unowned are sorted by path. Directories are listed instead of their files
+	// if none of their files is owned, top-level files and directories are the largest paths.
+	Unowned []UnownedPath
+}
+
+// RunAudit compares CODEOWNERS with the blame of the revision: every file belongs to
+// the last matching rule, and the share of its lines held by the owners of the rule is computed.
+//
+// Lines are counted as Author.Lines, the authors are not limited by Options.Top and Options.MinLines.
+func RunAudit(ctx context.Context, opts Options, auditOpts AuditOptions) (*AuditReport, error) {
+	threshold := auditOpts.Threshold
+	if threshold == 0 {
+		threshold = DefaultCodeownersThreshold
+	}
+	if threshold < 0 || threshold > 1 {
+		return nil, &OptionError{Option: "threshold", Err: fmt.Errorf("threshold %g is out of range", threshold)}
+	}
+
+	file := auditOpts.Codeowners
+	if file == nil {
+		var err error
+		if file, err = FindCodeowners(ctx, opts); err != nil {
+			return nil, err
+		}
+		if file == nil {
+			return nil, &OptionError{Option: "codeowners", Err: fmt.Errorf("no CODEOWNERS at %s in any of %s",
+				cmp.Or(opts.Revision, "HEAD"), strings.Join(CodeownersLocations, ", "))}
+		}
+	}
+
+	matcher, err := file.Compile()
+	if err != nil {
+		return nil, &OptionError{Option: "codeowners", Err: err}
+	}
+
+	report, err := Run(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	audit := &AuditReport{Report: report, Source: file.Source, Threshold: threshold}
+
+	// lines[i][name] are the lines of the author in the files of the i-th rule, -1 for the files matching none.
+	lines := make(map[int]map[string]int)
+	// mails[name][mail] are the lines of the author under the email.
+	mails := make(map[string]map[string]int)
+	files := make(map[int]int)
+	// owned[dir] is set if any file in the subtree of the directory is owned.
+	owned := make(map[string]bool)
+	// unowned[path] are the lines of the authors in the unowned file.
+	unowned := make(map[string]map[string]int)
+
+	for path, f := range report.State.Files {
+		i := matcher.Match(path)
+		if i >= 0 && len(file.Rules[i].Owners) > 0 {
+			for _, dir := range ancestors(path, strings.Count(path, "/")) {
+				owned[dir] = true
+			}
+		} else {
+			unowned[path] = make(map[string]int)
+		}
+
+		files[i]++
+		if lines[i] == nil {
+			lines[i] = make(map[string]int)
+		}
+		for hash := range f.Lines {
+			name, mail := authorOf(report.State.Commits[hash], report.UseCommitter)
+
+			n := f.counted(hash, report.Count)
+			lines[i][name] += n
+			if byName, ok := unowned[path]; ok {
+				byName[name] += n
+			}
+			if mails[name] == nil {
+				mails[name] = make(map[string]int)
+			}
+			if mail != "" {
+				mails[name][mail] += n
+			}
+		}
+	}
+
+	// owner returns the owner shown for the author: the handle, the email of the most lines or the name.
+	owner := func(name string) string {
+		if handle, ok := auditOpts.Handles[name]; ok {
+			return handle
+		}
+		return cmp.Or(topOwner(mails[name]), name)
+	}
+	// top returns the owner of the author of the most lines.
+	top := func(lines map[string]int) string {
+		name := topOwner(lines)
+		if name == "" {
+			return ""
+		}
+		return owner(name)
+	}
+	// holds reports whether the owner of a rule is the handle, an email or the name of the author.
+	holds := func(o, name string) bool {
+		if handle, ok := auditOpts.Handles[name]; ok && strings.EqualFold(o, handle) {
+			return true
+		}
+		for mail := range mails[name] {
+			if strings.EqualFold(o, mail) {
+				return true
+			}
+		}
+		return strings.EqualFold(o, name)
+	}
+
+	for i, rule := range file.Rules {
+		a := RuleAudit{CodeownersRule: rule, Files: files[i]}
+
+		var users []string
+		for _, o := range rule.Owners {
+			if codeowners.IsTeam(o) {
+				a.Teams = append(a.Teams, o)
+			} else {
+				users = append(users, o)
+			}
+		}
+
+		var held int
+		for name, n := range lines[i] {
+			a.Lines += n
+			if slices.ContainsFunc(users, func(o string) bool { return holds(o, name) }) {
+				held += n
+			}
+		}
+		a.Top = top(lines[i])
+		if a.Lines > 0 {
+			a.Share = float64(held) / float64(a.Lines)
+			a.Stale = len(users) > 0 && a.Share < threshold
+		}
+		audit.Rules = append(audit.Rules, a)
+	}
+
+	// The unowned files are collapsed into their largest unowned directories.
+	collapsed := make(map[string]map[string]int)
+	counts := make(map[string]int)
+	for path, byName := range unowned {
+		key := path
+		for _, dir := range ancestors(path, strings.Count(path, "/"))[1:] {
+			if !owned[dir] {
+				key = dir + "/"
+				break
+			}
+		}
+
+		if collapsed[key] == nil {
+			collapsed[key] = make(map[string]int)
+		}
+		for name, n := range byName {
+			collapsed[key][name] += n
+		}
+		counts[key]++
+	}
+
+	for path, byName := range collapsed {
+		u := UnownedPath{Path: path, Files: counts[path], Top: top(byName)}
+		for _, n := range byName {
+			u.Lines += n
+		}
+		audit.Unowned = append(audit.Unowned, u)
+	}
+	slices.SortFunc(audit.Unowned, func(a, b UnownedPath) int { return cmp.Compare(a.Path, b.Path) })
+
+	return audit, nil
+}
+
+// topOwner returns the owner of the most lines, the first by name of the ones with the same lines.
+func topOwner(lines map[string]int) string {
+	var top string
+	for owner, n := range lines {
+		if n > 0 && (top == "" || n > lines[top] || n == lines[top] && owner < top) {
+			top = owner
+		}
+	}
+	return top
+}
+
+// auditRow is the json encoding of RuleAudit and UnownedPath.
+type auditRow struct {
+	Kind string `json:"kind"`
+	// Line is zero for the unowned paths.
+	Line int `json:"line,omitempty"`
+	// Pattern is the path for the unowned paths.
+	Pattern string   `json:"pattern"`
+	Owners  []string `json:"owners,omitempty"`
+	Files   int      `json:"files"`
+	Lines   int      `json:"lines"`
+	Share   float64  `json:"share"`
+	Top     string   `json:"top,omitempty"`
+	Stale   bool     `json:"stale"`
+}
+
+// WriteAudit renders the report in the built-in output format:
+// a row per rule of CODEOWNERS, followed by a row per unowned path.
+func WriteAudit(w io.Writer, name string, r *AuditReport) error {
+	if err := format.Validate(name); err != nil {
+		return &OptionError{Option: "format", Err: err}
+	}
+
+	rows := make([]auditRow, 0, len(r.Rules)+len(r.Unowned))
+	for _, a := range r.Rules {
+		rows = append(rows, auditRow{
+			Kind:    AuditRule,
+			Line:    a.Line,
+			Pattern: a.Pattern,
+			Owners:  a.Owners,
+			Files:   a.Files,
+			Lines:   a.Lines,
+			Share:   roundShare(a.Share),
+			Top:     a.Top,
+			Stale:   a.Stale,
+		})
+	}
+	for _, u := range r.Unowned {
+		rows = append(rows, auditRow{Kind: AuditUnowned, Pattern: u.Path, Files: u.Files, Lines: u.Lines, Top: u.Top})
+	}
+
+	t := &format.Table[auditRow]{
+		Header: []string{"Kind", "Line", "Pattern", "Owners", "Files", "Lines", "Share", "Top", "Stale"},
+		Items:  rows,
+		Record: func(row *auditRow) []string {
+			line, share, stale := "-", "-", "-"
+			if row.Kind == AuditRule {
+				line = strconv.Itoa(row.Line)
+				share = strconv.FormatFloat(row.Share, 'f', -1, 64)
+				stale = strconv.FormatBool(row.Stale)
+			}
+			return []string{row.Kind, line, row.Pattern, cmp.Or(strings.Join(row.Owners, " "), "-"),
+				strconv.Itoa(row.Files), strconv.Itoa(row.Lines), share, cmp.Or(row.Top, "-"), stale}
+		},
+	}
+	return t.Write(w, name)
+}
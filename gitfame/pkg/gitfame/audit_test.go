@@ -0,0 +1,81 @@
+package gitfame
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/gitfame/internal/codeowners"
+)
+
+func TestRunAudit(t *testing.T) {
+	dir := cloneBundle(t, "go-cmp.bundle")
+
+	file := codeowners.Parse("CODEOWNERS", []byte(`*               @dsnet
+/cmp/internal/  @rogpeppe
+/cmp/internal/  @DSNET
+/cmp/cmpopts/   @rogpeppe
+/docs/          @nobody
+/cmp/testdata/
+/cmp/*.go       @google/go-cmp
+/cmp/options.go @google/go-cmp joetsai@digital-static.net
+`))
+
+	report, err := RunAudit(context.Background(), Options{Repository: dir}, AuditOptions{
+		Threshold:  0.5,
+		Handles:    map[string]string{"Joe Tsai": "@dsnet"},
+		Codeowners: file,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "CODEOWNERS", report.Source)
+	require.Len(t, report.Rules, len(file.Rules))
+
+	var files, lines int
+	for _, r := range report.Rules {
+		files += r.Files
+		lines += r.Lines
+	}
+	require.Len(t, report.State.Files, files)
+
+	// The last of the same patterns wins, owners are compared ignoring case.
+	require.Zero(t, report.Rules[1].Files)
+	require.Positive(t, report.Rules[2].Files)
+	require.Greater(t, report.Rules[2].Share, 0.9)
+	require.False(t, report.Rules[2].Stale)
+
+	require.Less(t, report.Rules[3].Share, 0.5)
+	require.True(t, report.Rules[3].Stale)
+	require.Equal(t, "@dsnet", report.Rules[3].Top)
+
+	require.Zero(t, report.Rules[4].Files)
+	require.False(t, report.Rules[4].Stale)
+
+	// Rules without owners are never stale, their files are unowned.
+	require.Zero(t, report.Rules[5].Share)
+	require.False(t, report.Rules[5].Stale)
+	require.Equal(t, []UnownedPath{{Path: "cmp/testdata/", Files: report.Rules[5].Files, Lines: report.Rules[5].Lines, Top: "@dsnet"}},
+		report.Unowned)
+
+	// Team owners hold no lines, rules with team owners only are never stale.
+	require.Positive(t, report.Rules[6].Files)
+	require.Equal(t, []string{"@google/go-cmp"}, report.Rules[6].Teams)
+	require.Zero(t, report.Rules[6].Share)
+	require.False(t, report.Rules[6].Stale)
+
+	// Authors without handles are matched by their emails.
+	require.Equal(t, 1, report.Rules[7].Files)
+	require.Greater(t, report.Rules[7].Share, 0.5)
+
+	var out bytes.Buffer
+	require.NoError(t, WriteAudit(&out, FormatCSV, report))
+	require.True(t, strings.HasPrefix(out.String(), "Kind,Line,Pattern,Owners,Files,Lines,Share,Top,Stale\nrule,1,*,@dsnet,"), out.String())
+	require.True(t, strings.HasSuffix(out.String(), "unowned,-,cmp/testdata/,-,1,1674,-,@dsnet,-\n"), out.String())
+
+	_, err = RunAudit(context.Background(), Options{Repository: dir}, AuditOptions{})
+	var optionErr *OptionError
+	require.ErrorAs(t, err, &optionErr)
+	require.Equal(t, "codeowners", optionErr.Option)
+}
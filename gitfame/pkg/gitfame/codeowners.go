@@ -0,0 +1,393 @@
+package gitfame
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	pathpkg "path"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gitlab.com/slon/shad-go/gitfame/internal/codeowners"
+	"gitlab.com/slon/shad-go/gitfame/internal/format"
+)
+
+// CodeownersRule is a rule of CODEOWNERS assigning the owners to the paths matching the pattern.
+type CodeownersRule = codeowners.Rule
+
+// CodeownersFile is a parsed CODEOWNERS.
+type CodeownersFile = codeowners.File
+
+// CodeownersLocations are the paths CODEOWNERS is looked for at in the tree, in the order of precedence.
+var CodeownersLocations = codeowners.Locations
+
+// DefaultCodeownersThreshold is the default CodeownersOptions.Threshold.
+const DefaultCodeownersThreshold = 0.2
+
+// CodeownersOptions configure RunCodeowners.
+type CodeownersOptions struct {
+	// Depth is the depth of the deepest directories getting rules, the root directory is 0.
+	Depth int
+	// Threshold is the least share of the lines of a directory an owner holds,
+	// DefaultCodeownersThreshold by default. Directories with no such authors
+	// are owned by the author of the most lines.
+	Threshold float64
+	// Handles map the names of the authors to the owners, e.g. @user.
+	// Authors without handles are owners under their emails, see CodeownersReport.Unmapped.
+	Handles map[string]string
+}
+
+// OwnersRule is a proposed rule of CODEOWNERS.
+type OwnersRule struct {
+	// CodeownersRule has the * pattern for the root directory and /dir/ for the others.
+	CodeownersRule
+	// Lines is the number of lines of the directory.
+	Lines int
+	// Share is the share of the Lines held by the owners.
+	Share float64
+}
+
+// CodeownersReport is the result of RunCodeowners.
+type CodeownersReport struct {
+	*Report
+	// Threshold and Depth are the ones the rules were proposed with.
+	Threshold float64
+	Depth     int
+	// Rules are sorted by pattern, the rules of the parent directories come first.
+	// Directories owned the same way as their parents have no rules.
+	Rules []OwnersRule
+	// Unmapped are the names of the authors owning the rules without handles, sorted.
+	// They are owners under their emails, or under their names if the emails are unknown,
+	// which makes the rules invalid, see WriteCodeowners.
+	Unmapped []string
+}
+
+// RunCodeowners proposes CODEOWNERS of the revision: the owners of every directory up to
+// the depth are the authors of at least the threshold share of the lines in its subtree.
+//
+// Lines are counted as Author.Lines, the authors are not limited by Options.Top and Options.MinLines.
+func RunCodeowners(ctx context.Context, opts Options, ownersOpts CodeownersOptions) (*CodeownersReport, error) {
+	threshold := ownersOpts.Threshold
+	if threshold == 0 {
+		threshold = DefaultCodeownersThreshold
+	}
+	if threshold < 0 || threshold > 1 {
+		return nil, &OptionError{Option: "threshold", Err: fmt.Errorf("threshold %g is out of range", threshold)}
+	}
+	if ownersOpts.Depth < 0 {
+		return nil, &OptionError{Option: "depth", Err: fmt.Errorf("negative depth %d", ownersOpts.Depth)}
+	}
+
+	report, err := Run(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	owners := &CodeownersReport{Report: report, Threshold: threshold, Depth: ownersOpts.Depth}
+
+	// lines[dir][owner] are the lines of the owner in the subtree of the directory, "" for the root one.
+	lines := make(map[string]map[string]int)
+	// mails[name][mail] are the lines of the emails of the authors without handles.
+	mails := make(map[string]map[string]int)
+	for path, f := range report.State.Files {
+		for hash := range f.Lines {
+			n := f.counted(hash, report.Count)
+			name, mail := authorOf(report.State.Commits[hash], report.UseCommitter)
+			owner, ok := ownersOpts.Handles[name]
+			if !ok {
+				owner = name
+				if mails[name] == nil {
+					mails[name] = make(map[string]int)
+				}
+				if mail != "" {
+					mails[name][mail] += n
+				}
+			}
+
+			for _, dir := range ancestors(path, ownersOpts.Depth) {
+				if lines[dir] == nil {
+					lines[dir] = make(map[string]int)
+				}
+				lines[dir][owner] += n
+			}
+		}
+	}
+
+	dirs := make([]string, 0, len(lines))
+	for dir := range lines {
+		dirs = append(dirs, dir)
+	}
+	// The parents come first with the trailing slashes, the root one is the first.
+	slices.SortFunc(dirs, func(a, b string) int {
+		if a == "" || b == "" {
+			return cmp.Compare(len(a), len(b))
+		}
+		return cmp.Compare(a+"/", b+"/")
+	})
+
+	// inherited are the owners of the directories, with the rules or not.
+	inherited := make(map[string]string)
+	names := make(map[string]bool)
+	for _, dir := range dirs {
+		rule, ok := proposeRule(dir, lines[dir], threshold)
+		if !ok {
+			continue
+		}
+
+		key := strings.Join(rule.Owners, " ")
+		inherited[dir] = key
+		if parent, ok := inheritedOwners(inherited, dir); ok && parent == key {
+			continue
+		}
+
+		// The authors without handles own the rules under the emails of the most lines.
+		rule.Owners = slices.Clone(rule.Owners)
+		for i, name := range rule.Owners {
+			if byMail, ok := mails[name]; ok {
+				names[name] = true
+				rule.Owners[i] = cmp.Or(topOwner(byMail), name)
+			}
+		}
+		owners.Rules = append(owners.Rules, rule)
+	}
+
+	for name := range names {
+		owners.Unmapped = append(owners.Unmapped, name)
+	}
+	slices.Sort(owners.Unmapped)
+
+	return owners, nil
+}
+
+// authorOf returns the name and the email of the author of the commit, or of its committer with useCommitter.
+// The email is empty in the states written before the emails were kept.
+func authorOf(c StateCommit, useCommitter bool) (name, mail string) {
+	if useCommitter {
+		return c.Committer, c.CommitterMail
+	}
+	return c.Author, c.AuthorMail
+}
+
+// validOwner reports whether the owner is valid in CODEOWNERS: a user or a team handle, or an email.
+func validOwner(owner string) bool {
+	return strings.Contains(owner, "@") && !strings.ContainsFunc(owner, unicode.IsSpace)
+}
+
+// ancestors returns the directories of the path up to the depth, "" for the root one.
+func ancestors(path string, depth int) []string {
+	dirs := []string{""}
+	parts := strings.Split(path, "/")
+	for i := 1; i < len(parts) && i <= depth; i++ {
+		dirs = append(dirs, strings.Join(parts[:i], "/"))
+	}
+	return dirs
+}
+
+// inheritedOwners returns the owners of the closest parent of the directory with any.
+func inheritedOwners(inherited map[string]string, dir string) (string, bool) {
+	for dir != "" {
+		if dir = pathpkg.Dir(dir); dir == "." {
+			dir = ""
+		}
+		if owners, ok := inherited[dir]; ok {
+			return owners, true
+		}
+	}
+	return "", false
+}
+
+// proposeRule returns the rule of the directory with the lines of the owners,
+// false if there are no lines.
+func proposeRule(dir string, lines map[string]int, threshold float64) (OwnersRule, bool) {
+	type owner struct {
+		name  string
+		lines int
+	}
+
+	var total int
+	var sorted []owner
+	for name, n := range lines {
+		total += n
+		sorted = append(sorted, owner{name: name, lines: n})
+	}
+	if total == 0 {
+		return OwnersRule{}, false
+	}
+	slices.SortFunc(sorted, func(a, b owner) int { return cmp.Or(cmp.Compare(b.lines, a.lines), cmp.Compare(a.name, b.name)) })
+
+	rule := OwnersRule{CodeownersRule: CodeownersRule{Pattern: "*"}, Lines: total}
+	if dir != "" {
+		rule.Pattern = "/" + dir + "/"
+	}
+
+	var held int
+	for i, o := range sorted {
+		if i > 0 && float64(o.lines) < threshold*float64(total) {
+			break
+		}
+		rule.Owners = append(rule.Owners, o.name)
+		held += o.lines
+	}
+	rule.Share = float64(held) / float64(total)
+	return rule, true
+}
+
+// ReadHandles reads the mapping of the names of the authors to the owners from the file.
+//
+// Every line holds the owner, e.g. @user or user@example.com, followed by the name of the author,
+// separated by whitespace. Blank lines and lines starting with # are skipped.
+func ReadHandles(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	handles := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		i := strings.IndexFunc(line, unicode.IsSpace)
+		if i < 0 {
+			return nil, fmt.Errorf("%s:%d: expected handle and name", path, n)
+		}
+		handles[strings.TrimSpace(line[i:])] = line[:i]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return handles, nil
+}
+
+// FindCodeowners reads the first CODEOWNERS of CodeownersLocations in the tree of the revision.
+//
+// FindCodeowners returns nil if there is none.
+func FindCodeowners(ctx context.Context, opts Options) (*CodeownersFile, error) {
+	opts.setDefaults()
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	_, repo, err := opts.open()
+	if err != nil {
+		return nil, err
+	}
+	if repo == nil {
+		return nil, &OptionError{Option: "backend", Err: fmt.Errorf("reading CODEOWNERS requires the %s backend", BackendGit)}
+	}
+
+	return codeowners.Find(ctx, repo, opts.Revision)
+}
+
+// ReadCodeowners reads CODEOWNERS from the file system.
+func ReadCodeowners(path string) (*CodeownersFile, error) {
+	return codeowners.ReadFile(path)
+}
+
+// DiffCodeowners compares the proposed rules with the existing ones, the last of the same pattern.
+//
+// The result lists the lines of the existing rules prefixed with - and of the proposed rules
+// prefixed with + for patterns with different owners, missing or extra; it is empty if the owners agree.
+// Patterns matching the same paths are the same, the order of the rules and of the owners does not matter.
+func DiffCodeowners(proposed []OwnersRule, existing *CodeownersFile) []string {
+	old := make(map[string]CodeownersRule)
+	var patterns []string
+	for _, r := range existing.Rules {
+		key := codeowners.Normalize(r.Pattern)
+		if _, ok := old[key]; !ok {
+			patterns = append(patterns, key)
+		}
+		old[key] = r
+	}
+
+	var diff []string
+	for _, p := range proposed {
+		key := codeowners.Normalize(p.Pattern)
+		o, ok := old[key]
+		delete(old, key)
+		if ok && sameOwners(o.Owners, p.Owners) {
+			continue
+		}
+		if ok {
+			diff = append(diff, "-"+o.String())
+		}
+		diff = append(diff, "+"+p.String())
+	}
+
+	for _, key := range patterns {
+		if o, ok := old[key]; ok {
+			diff = append(diff, "-"+o.String())
+		}
+	}
+	return diff
+}
+
+func sameOwners(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
+
+// ownersRow is the json encoding of OwnersRule.
+type ownersRow struct {
+	Pattern string   `json:"pattern"`
+	Owners  []string `json:"owners"`
+	Lines   int      `json:"lines"`
+	Share   float64  `json:"share"`
+}
+
+// WriteCodeowners renders the report in the built-in output format: tabular writes CODEOWNERS
+// with the rules of owners without handles and emails commented out, the other formats
+// a row of the pattern, the owners, the lines and their share per rule.
+func WriteCodeowners(w io.Writer, name string, r *CodeownersReport) error {
+	if err := format.Validate(name); err != nil {
+		return &OptionError{Option: "format", Err: err}
+	}
+
+	if name == FormatTabular {
+		if _, err := fmt.Fprintf(w, "# Proposed by gitfame codeowners at %s: owners hold at least %s%% of the lines\n# of the directories up to depth %d.\n",
+			r.Revision, strconv.FormatFloat(r.Threshold*100, 'f', -1, 64), r.Depth); err != nil {
+			return err
+		}
+		for _, rule := range r.Rules {
+			line := rule.String()
+			// GitHub rejects the rules of owners without handles and emails.
+			if slices.ContainsFunc(rule.Owners, func(o string) bool { return !validOwner(o) }) {
+				line = "# " + line
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	rows := make([]ownersRow, 0, len(r.Rules))
+	for _, rule := range r.Rules {
+		rows = append(rows, ownersRow{Pattern: rule.Pattern, Owners: rule.Owners, Lines: rule.Lines, Share: roundShare(rule.Share)})
+	}
+
+	t := &format.Table[ownersRow]{
+		Header: []string{"Pattern", "Owners", "Lines", "Share"},
+		Items:  rows,
+		Record: func(row *ownersRow) []string {
+			return []string{row.Pattern, strings.Join(row.Owners, " "), strconv.Itoa(row.Lines), strconv.FormatFloat(row.Share, 'f', -1, 64)}
+		},
+	}
+	return t.Write(w, name)
+}
+
+// roundShare rounds the share to 3 digits.
+func roundShare(share float64) float64 {
+	return float64(int(share*1000+0.5)) / 1000
+}
@@ -0,0 +1,115 @@
+package gitfame
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunCodeowners(t *testing.T) {
+	dir := cloneBundle(t, "go-cmp.bundle")
+
+	report, err := RunCodeowners(context.Background(), Options{Repository: dir},
+		CodeownersOptions{Depth: 2, Threshold: 0.03, Handles: map[string]string{"Joe Tsai": "@dsnet"}})
+	require.NoError(t, err)
+
+	var patterns []string
+	for _, r := range report.Rules {
+		patterns = append(patterns, r.Pattern)
+		require.Equal(t, "@dsnet", r.Owners[0], r.Pattern)
+		require.GreaterOrEqual(t, r.Share, 0.9, r.Pattern)
+	}
+	require.Equal(t, []string{"*", "/.github/", "/cmp/cmpopts/", "/cmp/testdata/"}, patterns)
+	require.Equal(t, []string{"@dsnet"}, report.Rules[0].Owners)
+	require.Equal(t, []string{"A. Ishikawa", "Tobias Klauser", "colinnewell"}, report.Unmapped)
+
+	root, err := RunCodeowners(context.Background(), Options{Repository: dir}, CodeownersOptions{})
+	require.NoError(t, err)
+	require.Len(t, root.Rules, 1)
+	require.Equal(t, report.Rules[0].Lines, root.Rules[0].Lines)
+	// Authors without handles own the rules under their emails.
+	require.Equal(t, []string{"joetsai@digital-static.net"}, root.Rules[0].Owners)
+	require.Equal(t, []string{"Joe Tsai"}, root.Unmapped)
+
+	var out bytes.Buffer
+	require.NoError(t, WriteCodeowners(&out, FormatTabular, report))
+	existing := filepath.Join(t.TempDir(), "CODEOWNERS")
+	require.NoError(t, os.WriteFile(existing, out.Bytes(), 0o644))
+
+	file, err := ReadCodeowners(existing)
+	require.NoError(t, err)
+	require.Empty(t, DiffCodeowners(report.Rules, file))
+
+	missing, err := FindCodeowners(context.Background(), Options{Repository: dir})
+	require.NoError(t, err)
+	require.Nil(t, missing)
+
+	_, err = RunCodeowners(context.Background(), Options{Repository: dir}, CodeownersOptions{Threshold: 2})
+	var optionErr *OptionError
+	require.ErrorAs(t, err, &optionErr)
+	require.Equal(t, "threshold", optionErr.Option)
+}
+
+func TestDiffCodeowners(t *testing.T) {
+	proposed := []OwnersRule{
+		{CodeownersRule: CodeownersRule{Pattern: "*", Owners: []string{"@a"}}},
+		{CodeownersRule: CodeownersRule{Pattern: "/docs/", Owners: []string{"@b", "@c"}}},
+		{CodeownersRule: CodeownersRule{Pattern: "/new/", Owners: []string{"@d"}}},
+	}
+	existing := &CodeownersFile{Rules: []CodeownersRule{
+		{Pattern: "*", Owners: []string{"@a"}},
+		{Pattern: "/old/", Owners: []string{"@x"}},
+		{Pattern: "/docs/", Owners: []string{"@x"}},
+		{Pattern: "/docs/", Owners: []string{"@c", "@b"}},
+		{Pattern: "/new/", Owners: []string{"@x"}},
+	}}
+
+	require.Equal(t, []string{"-/new/ @x", "+/new/ @d", "-/old/ @x"}, DiffCodeowners(proposed, existing))
+	require.Equal(t, []string{"+* @a", "+/docs/ @b @c", "+/new/ @d"}, DiffCodeowners(proposed, &CodeownersFile{}))
+
+	// Patterns of the same paths are the same rules.
+	existing = &CodeownersFile{Rules: []CodeownersRule{
+		{Pattern: "new/**", Owners: []string{"@d"}},
+		{Pattern: "/docs/**", Owners: []string{"@c", "@b"}},
+		{Pattern: "**", Owners: []string{"@a"}},
+	}}
+	require.Empty(t, DiffCodeowners(proposed, existing))
+
+	// docs/ matches at any depth, unlike /docs/.
+	existing = &CodeownersFile{Rules: []CodeownersRule{
+		{Pattern: "*", Owners: []string{"@a"}},
+		{Pattern: "docs/", Owners: []string{"@b", "@c"}},
+		{Pattern: "/new/", Owners: []string{"@d"}},
+	}}
+	require.Equal(t, []string{"+/docs/ @b @c", "-docs/ @b @c"}, DiffCodeowners(proposed, existing))
+}
+
+func TestWriteCodeowners(t *testing.T) {
+	report := &CodeownersReport{Report: &Report{}, Rules: []OwnersRule{
+		{CodeownersRule: CodeownersRule{Pattern: "*", Owners: []string{"@a", "b@example.com"}}},
+		{CodeownersRule: CodeownersRule{Pattern: "/docs/", Owners: []string{"@a", "Rob Pike"}}},
+	}}
+
+	var out bytes.Buffer
+	require.NoError(t, WriteCodeowners(&out, FormatTabular, report))
+	require.Contains(t, out.String(), "\n* @a b@example.com\n")
+	// GitHub rejects the owners without handles and emails.
+	require.Contains(t, out.String(), "\n# /docs/ @a Rob Pike\n")
+}
+
+func TestReadHandles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "handles")
+	require.NoError(t, os.WriteFile(path, []byte("# maintainers\n@dsnet Joe Tsai\n\n  rob@example.com\tRob Pike\n"), 0o644))
+
+	handles, err := ReadHandles(path)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"Joe Tsai": "@dsnet", "Rob Pike": "rob@example.com"}, handles)
+
+	require.NoError(t, os.WriteFile(path, []byte("@dsnet\n"), 0o644))
+	_, err = ReadHandles(path)
+	require.ErrorContains(t, err, ":1: expected handle and name")
+}
@@ -0,0 +1,37 @@
+package gitfame
+
+import (
+	"errors"
+	"fmt"
+
+	"gitlab.com/slon/shad-go/gitfame/internal/git"
+)
+
+var (
+	// ErrInvalidOptions is returned for malformed or inconsistent options,
+	// the error is an *OptionError.
+	ErrInvalidOptions = errors.New("invalid options")
+	// ErrUnknownRevision is returned when the revision does not name a commit of the repository.
+	ErrUnknownRevision = git.ErrUnknownRevision
+	// ErrRepositoryNotFound is returned when the repository directory does not exist
+	// or is not a git repository.
+	ErrRepositoryNotFound = git.ErrRepositoryNotFound
+)
+
+// GitError is a failure of a git command.
+type GitError = git.Error
+
+// OptionError reports an invalid option, it matches ErrInvalidOptions.
+type OptionError struct {
+	// Option is the name of the gitfame flag corresponding to the option, e.g. "order-by".
+	Option string
+	Err    error
+}
+
+func (e *OptionError) Error() string {
+	return fmt.Sprintf("%v: %s: %v", ErrInvalidOptions, e.Option, e.Err)
+}
+
+func (e *OptionError) Unwrap() []error {
+	return []error{ErrInvalidOptions, e.Err}
+}
@@ -0,0 +1,162 @@
+package gitfame
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"sync"
+
+	"gitlab.com/slon/shad-go/gitfame/internal/git"
+	"gitlab.com/slon/shad-go/gitfame/internal/stats"
+)
+
+// Exclude modes.
+const (
+	// ExcludeModeIgnore attributes lines of the excluded commits to the commits
+	// that previously modified them, as git blame --ignore-rev does.
+	ExcludeModeIgnore = "ignore"
+	// ExcludeModeDrop drops lines of the excluded commits.
+	ExcludeModeDrop = "drop"
+)
+
+// ExcludeModes lists supported exclude modes.
+var ExcludeModes = []string{ExcludeModeIgnore, ExcludeModeDrop}
+
+// commitExcluder excludes commits with messages matching a regular expression.
+//
+// Every message is read once, commitExcluder is safe for concurrent use.
+type commitExcluder struct {
+	repo    *git.Repository
+	rev     string
+	re      *regexp.Regexp
+	drop    bool
+	objects *git.ObjectReader
+
+	mu       sync.Mutex
+	excluded map[string]bool
+}
+
+func newCommitExcluder(ctx context.Context, repo *git.Repository, rev string, re *regexp.Regexp, mode string) *commitExcluder {
+	return &commitExcluder{
+		repo:     repo,
+		rev:      rev,
+		re:       re,
+		drop:     mode == ExcludeModeDrop,
+		objects:  repo.NewObjectReader(ctx),
+		excluded: make(map[string]bool),
+	}
+}
+
+func (e *commitExcluder) Close() error {
+	return e.objects.Close()
+}
+
+// isExcluded reports whether the message of the commit matches.
+func (e *commitExcluder) isExcluded(hash string) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if excluded, ok := e.excluded[hash]; ok {
+		return excluded, nil
+	}
+
+	_, data, err := e.objects.Read(hash)
+	if err != nil {
+		return false, err
+	}
+	message, err := git.CommitMessage(data)
+	if err != nil {
+		return false, err
+	}
+
+	e.excluded[hash] = e.re.MatchString(message)
+	return e.excluded[hash], nil
+}
+
+// apply removes the excluded commits from the blame result of the file.
+//
+// In the ignore mode files are blamed again with blame ignoring the excluded
+// commits until no new excluded commit shows up. Lines git can not attribute
+// to any other commit, e.g. added by an excluded commit, are dropped.
+func (e *commitExcluder) apply(
+	ctx context.Context, path string, r *blameResult, blame func(ignoreRevs ...string) (map[*git.Commit]stats.Lines, error),
+) error {
+	if r.last != nil {
+		return e.applyEmpty(ctx, path, r)
+	}
+
+	ignored := make(map[string]bool)
+	for {
+		var excluded []string
+		for c := range r.lines {
+			if ignored[c.Hash] {
+				continue
+			}
+
+			ok, err := e.isExcluded(c.Hash)
+			if err != nil {
+				return err
+			}
+			if ok {
+				ignored[c.Hash] = true
+				excluded = append(excluded, c.Hash)
+			}
+		}
+
+		if len(excluded) == 0 || e.drop {
+			break
+		}
+
+		revs := make([]string, 0, len(ignored))
+		for hash := range ignored {
+			revs = append(revs, hash)
+		}
+		slices.Sort(revs)
+
+		lines, err := blame(revs...)
+		if err != nil {
+			return err
+		}
+		r.lines = lines
+	}
+
+	for c := range r.lines {
+		if ignored[c.Hash] {
+			delete(r.lines, c)
+		}
+	}
+
+	return nil
+}
+
+// applyEmpty attributes the empty file to the last commit not excluded
+// in the ignore mode or drops it.
+func (e *commitExcluder) applyEmpty(ctx context.Context, path string, r *blameResult) error {
+	ok, err := e.isExcluded(r.last.Hash)
+	if err != nil || !ok {
+		return err
+	}
+
+	r.last = nil
+	if e.drop {
+		return nil
+	}
+
+	history, err := e.repo.FileHistory(ctx, e.rev, path)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range history {
+		ok, err := e.isExcluded(hash)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			r.last, err = e.repo.ReadCommit(ctx, hash)
+			return err
+		}
+	}
+
+	return nil
+}
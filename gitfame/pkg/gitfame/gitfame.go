@@ -0,0 +1,818 @@
+// Package gitfame calculates authorship statistics of git repositories.
+//
+// It is the library behind the gitfame command: every line of the selected
+// files is attributed to the last commit that modified it, and the number of
+// lines, commits and files is reported per author.
+package gitfame
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+
+	"gitlab.com/slon/shad-go/gitfame/internal/filter"
+	"gitlab.com/slon/shad-go/gitfame/internal/git"
+	"gitlab.com/slon/shad-go/gitfame/internal/languages"
+	"gitlab.com/slon/shad-go/gitfame/internal/stats"
+)
+
+// Order keys.
+const (
+	OrderByLines   = stats.OrderByLines
+	OrderByCommits = stats.OrderByCommits
+	OrderByFiles   = stats.OrderByFiles
+	OrderByName    = stats.OrderByName
+)
+
+// Sources of the commits counts.
+const (
+	// CommitsFromBlame counts the commits that last modified the lines of the files.
+	CommitsFromBlame = "blame"
+	// CommitsFromLog counts the non-merge commits that modified the files in the history of the revision.
+	CommitsFromLog = "log"
+)
+
+// CommitsFromSources lists supported sources of the commits counts.
+var CommitsFromSources = []string{CommitsFromBlame, CommitsFromLog}
+
+// Keys the authors are grouped by.
+const (
+	// GroupByName groups the commits by the names of the authors.
+	GroupByName = "name"
+	// GroupByEmail groups the commits by the emails of the authors ignoring case.
+	GroupByEmail = "email"
+	// GroupByDomain groups the commits by the domains of the emails of the authors ignoring case.
+	GroupByDomain = "domain"
+)
+
+// GroupByKeys lists supported keys the authors are grouped by.
+var GroupByKeys = []string{GroupByName, GroupByEmail, GroupByDomain}
+
+// Kinds of the counted lines.
+const (
+	CountAll      = "all"
+	CountCode     = "code"
+	CountComments = "comments"
+	CountBlank    = "blank"
+)
+
+// Counts lists supported kinds of the counted lines.
+var Counts = []string{CountAll, CountCode, CountComments, CountBlank}
+
+// Backends reading the repository.
+const (
+	// BackendGit runs the git command.
+	BackendGit = "git"
+	// BackendGoGit reads the repository with the go-git library and does not need git to be installed.
+	// It ignores the mailmap and does not support Mailmap, SkipBinary, ExcludeCommitMessage,
+	// CommitsFromLog and Since.
+	BackendGoGit = "go-git"
+)
+
+// Backends lists supported backends.
+var Backends = []string{BackendGit, BackendGoGit}
+
+// Others is the name of the row the authors beyond Options.Top are folded into.
+const Others = "(others)"
+
+// Pattern syntaxes.
+const (
+	SyntaxGlob      = filter.SyntaxGlob
+	SyntaxGitignore = filter.SyntaxGitignore
+)
+
+// Options mirror the flags of the gitfame command.
+//
+// The zero value calculates statistics of HEAD of the repository
+// in the current directory.
+type Options struct {
+	// Repository is the path to the repository, the current directory by default.
+	Repository string
+	// Revision is the commit to calculate statistics for, HEAD by default.
+	Revision string
+	// OrderBy is a comma-separated list of sort keys, OrderByLines by default.
+	// Keys are OrderByLines, OrderByCommits, OrderByFiles and OrderByName,
+	// optionally prefixed with + for the ascending or - for the descending direction.
+	// Numeric keys are descending and the name is ascending by default.
+	OrderBy string
+	// UseCommitter attributes lines to committers instead of authors.
+	UseCommitter bool
+	// GroupBy is the key the authors are grouped by, GroupByName by default.
+	// It is case-insensitive. Authors grouped by emails or domains are named after them,
+	// commits without emails keep the names of the authors.
+	GroupBy string
+	// Mailmap is the path to a mailmap file mapping the names of the authors and the committers
+	// on top of the .mailmap of the repository, see the mailmap.file option of git.
+	Mailmap string
+	// Backend reads the repository, BackendGit by default.
+	Backend string
+
+	// backend replaces Backend if set, e.g. with git.Replay in tests.
+	backend git.Backend
+
+	// Extensions restricts files to the ones with any of the extensions, e.g. ".go".
+	Extensions []string
+	// Languages restricts files to the ones of any of the languages, e.g. "go".
+	// Unknown languages impose no restrictions and are reported in Report.Warnings.
+	Languages []string
+	// LanguagesConfig is the path to a language mapping replacing the built-in one.
+	LanguagesConfig string
+	// LanguagesConfigMerge merges LanguagesConfig on top of the built-in mapping.
+	LanguagesConfigMerge bool
+
+	// Exclude excludes files matching the patterns.
+	Exclude []string
+	// RestrictTo excludes files matching none of the patterns.
+	RestrictTo []string
+	// PatternSyntax is the syntax of Exclude and RestrictTo, SyntaxGlob by default.
+	PatternSyntax string
+	// Paths limits the files to the subtrees of the directories, e.g. "cmp/internal".
+	Paths []string
+	// StripPath reports paths of the files relative to the single directory of Paths,
+	// e.g. in Report.Skipped. Exclude and RestrictTo match them as well as the full paths.
+	StripPath bool
+
+	// MaxFileSize skips files larger than MaxFileSize bytes, zero keeps files of any size.
+	MaxFileSize int64
+	// SkipBinary skips binary files: the ones with the diff gitattribute unset,
+	// e.g. by the binary macro, and the ones with NUL bytes.
+	SkipBinary bool
+
+	// ExcludeCommitMessage is a regular expression excluding commits
+	// with matching messages from the attribution.
+	ExcludeCommitMessage string
+	// ExcludeMode defines the attribution of lines of the excluded commits,
+	// ExcludeModeIgnore by default.
+	ExcludeMode string
+
+	// CommitsFrom is the source of the commits counts, CommitsFromBlame by default.
+	CommitsFrom string
+
+	// Count is the kind of lines reported in Author.Lines, CountAll by default.
+	// Kinds are told apart by the comment syntax of the languages, see LanguagesConfig.
+	Count string
+	// Classify breaks lines down by kind in Author.Code, Author.Comments and Author.Blank.
+	// It is implied by Count other than CountAll.
+	Classify bool
+
+	// MinLines drops authors with fewer lines.
+	MinLines int
+	// Top keeps the first Top authors and folds the rest into a single
+	// Others row placed last, zero keeps all authors.
+	Top int
+
+	// Since is the state of a previous report. Files not changed since its
+	// revision are not blamed again, their attribution is taken from the state.
+	Since *State
+
+	// PartialOK makes Run report the files blamed before ctx is done
+	// instead of failing with its error, see Report.Partial.
+	PartialOK bool
+
+	// Progress is called after each blamed file if set.
+	Progress func(done, total int)
+}
+
+func (o *Options) setDefaults() {
+	if o.Repository == "" {
+		o.Repository = "."
+	}
+	if o.Revision == "" {
+		o.Revision = "HEAD"
+	}
+	if o.OrderBy == "" {
+		o.OrderBy = OrderByLines
+	}
+	o.GroupBy = strings.ToLower(strings.TrimSpace(o.GroupBy))
+	if o.GroupBy == "" {
+		o.GroupBy = GroupByName
+	}
+	if o.Backend == "" {
+		o.Backend = BackendGit
+	}
+	if o.PatternSyntax == "" {
+		o.PatternSyntax = SyntaxGlob
+	}
+	if o.ExcludeMode == "" {
+		o.ExcludeMode = ExcludeModeIgnore
+	}
+	if o.CommitsFrom == "" {
+		o.CommitsFrom = CommitsFromBlame
+	}
+	if o.Count == "" {
+		o.Count = CountAll
+	}
+	if o.Count != CountAll {
+		o.Classify = true
+	}
+	if o.Progress == nil {
+		o.Progress = func(done, total int) {}
+	}
+}
+
+// Author holds statistics of a single author.
+type Author struct {
+	Name    string `json:"name"`
+	Lines   int    `json:"lines"`
+	Commits int    `json:"commits"`
+	Files   int    `json:"files"`
+
+	// Code, Comments and Blank break all lines of the author down by kind,
+	// set if Options.Classify is.
+	Code     int `json:"-"`
+	Comments int `json:"-"`
+	Blank    int `json:"-"`
+}
+
+// Report is the result of Run.
+type Report struct {
+	// Revision is the hash of the analyzed commit.
+	Revision string
+	// Authors are sorted according to Options.OrderBy.
+	Authors []Author
+	// Warnings describe ignored options, e.g. unknown languages.
+	Warnings []string
+	// CommitsFrom is the source of the commits counts, see Options.CommitsFrom.
+	CommitsFrom string
+	// Count is the kind of lines counted in Author.Lines, see Options.Count.
+	Count string
+	// UseCommitter is set if the lines are attributed to committers, see Options.UseCommitter.
+	UseCommitter bool
+	// GroupBy is the key the authors are grouped by, see Options.GroupBy.
+	GroupBy string
+	// Folded are the names of the authors folded into the Others row, see Options.Top.
+	Folded []string
+	// StripPrefix is stripped from the reported paths, see Options.StripPath.
+	StripPrefix string
+	// Skipped are the selected files excluded from blame, see Options.MaxFileSize and Options.SkipBinary.
+	Skipped []SkippedFile
+	// State is the attribution of the analyzed files, see Options.Since.
+	State *State
+	// Partial is set if ctx was done before all files were blamed, see Options.PartialOK.
+	// Authors and State cover the blamed files only, commits are not counted from the log.
+	// Warnings tell how many files were blamed.
+	Partial bool
+
+	// Repositories are the reports of the individual repositories, set by RunRepositories only.
+	Repositories []RepositoryReport
+}
+
+// Run calculates statistics of the repository.
+func Run(ctx context.Context, opts Options) (*Report, error) {
+	opts.setDefaults()
+
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	report := &Report{CommitsFrom: opts.CommitsFrom, Count: opts.Count, UseCommitter: opts.UseCommitter, GroupBy: opts.GroupBy}
+	if opts.StripPath {
+		report.StripPrefix = opts.Paths[0] + "/"
+	}
+
+	f, mapping, err := newFilter(&opts, report)
+	if err != nil {
+		return nil, err
+	}
+
+	backend, repo, err := opts.open()
+	if err != nil {
+		return nil, err
+	}
+
+	report.Revision, err = backend.ResolveRevision(ctx, opts.Revision)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := backend.ListTree(ctx, report.Revision, opts.Paths...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range opts.Paths {
+		if !slices.ContainsFunc(files, func(f git.File) bool { return f.Path == p || strings.HasPrefix(f.Path, p+"/") }) {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("path %q matches no files", p))
+		}
+	}
+
+	var matched []git.File
+	for _, file := range files {
+		if f.Match(file.Path) {
+			matched = append(matched, file)
+		}
+	}
+
+	selected, skipped, err := skipFiles(ctx, repo, report.Revision, matched, &opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range skipped {
+		report.Skipped = append(report.Skipped, SkippedFile{Path: opts.reportedPath(f.Path), Reason: f.Reason})
+	}
+
+	hash, err := optionsHash(&opts, mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	reused, err := reusableFiles(ctx, repo, report, &opts, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	var blamed []string
+	for _, path := range selected {
+		if _, ok := reused[path]; !ok {
+			blamed = append(blamed, path)
+		}
+	}
+
+	var excluder *commitExcluder
+	if opts.ExcludeCommitMessage != "" {
+		excluder = newCommitExcluder(ctx, repo, report.Revision, regexp.MustCompile(opts.ExcludeCommitMessage), opts.ExcludeMode)
+		defer func() { _ = excluder.Close() }()
+	}
+
+	results, err := blameFiles(ctx, backend, report.Revision, blamed, excluder, mapping, &opts)
+	if err != nil {
+		return nil, err
+	}
+
+	report.Partial = len(results) < len(blamed)
+	if report.Partial {
+		report.Warnings = append(report.Warnings,
+			fmt.Sprintf("partial results: %d of %d files blamed before the run was interrupted", len(results), len(blamed)))
+	}
+
+	report.State = newState(report.Revision, &opts, hash)
+	for _, path := range selected {
+		if f, ok := reused[path]; ok {
+			report.State.addFile(path, f, opts.Since.Commits)
+		} else if r, ok := results[path]; ok {
+			report.State.addResult(path, r)
+		}
+	}
+
+	// Git can not be run once ctx is done.
+	if opts.CommitsFrom == CommitsFromLog && !report.Partial {
+		if err := addLogCommits(ctx, repo, report.State, selected, excluder); err != nil {
+			return nil, err
+		}
+	}
+
+	collector := stats.NewCollector(opts.UseCommitter, opts.CommitsFrom == CommitsFromLog)
+	report.State.addTo(collector, "", opts.GroupBy)
+
+	report.Authors, report.Folded, err = sortedAuthors(collector, &opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// validate checks options not validated by their consumers before doing any work.
+func (o *Options) validate() error {
+	if !slices.Contains(Backends, o.Backend) {
+		return &OptionError{Option: "backend", Err: fmt.Errorf("unknown backend %q", o.Backend)}
+	}
+	if option := o.gitOption(); option != "" && (o.Backend != BackendGit || o.backend != nil) {
+		return &OptionError{Option: "backend", Err: fmt.Errorf("%s requires the %s backend", option, BackendGit)}
+	}
+	if err := stats.Sort(nil, o.OrderBy); err != nil {
+		return &OptionError{Option: "order-by", Err: err}
+	}
+	if _, err := regexp.Compile(o.ExcludeCommitMessage); err != nil {
+		return &OptionError{Option: "exclude-commit-message", Err: err}
+	}
+	if !slices.Contains(ExcludeModes, o.ExcludeMode) {
+		return &OptionError{Option: "exclude-mode", Err: fmt.Errorf("unknown exclude mode %q", o.ExcludeMode)}
+	}
+	if !slices.Contains(GroupByKeys, o.GroupBy) {
+		return &OptionError{Option: "group-by", Err: fmt.Errorf("unknown key %q, expected one of %s", o.GroupBy, strings.Join(GroupByKeys, ", "))}
+	}
+	if !slices.Contains(CommitsFromSources, o.CommitsFrom) {
+		return &OptionError{Option: "commits-from", Err: fmt.Errorf("unknown commits source %q", o.CommitsFrom)}
+	}
+	if !slices.Contains(Counts, o.Count) {
+		return &OptionError{Option: "count", Err: fmt.Errorf("unknown kind of lines %q", o.Count)}
+	}
+	if o.MinLines < 0 {
+		return &OptionError{Option: "min-lines", Err: fmt.Errorf("negative value %d", o.MinLines)}
+	}
+	if o.MaxFileSize < 0 {
+		return &OptionError{Option: "max-file-size", Err: fmt.Errorf("negative value %d", o.MaxFileSize)}
+	}
+	if o.Top < 0 {
+		return &OptionError{Option: "top", Err: fmt.Errorf("negative value %d", o.Top)}
+	}
+	if o.Mailmap != "" {
+		// Git runs in the repository directory and silently ignores missing files.
+		mailmap, err := filepath.Abs(o.Mailmap)
+		if err == nil {
+			_, err = os.Stat(mailmap)
+		}
+		if err != nil {
+			return &OptionError{Option: "mailmap", Err: err}
+		}
+		o.Mailmap = mailmap
+	}
+
+	paths, err := cleanPaths(o.Paths)
+	if err != nil {
+		return &OptionError{Option: "path", Err: err}
+	}
+	o.Paths = paths
+	if o.StripPath && len(o.Paths) != 1 {
+		return &OptionError{Option: "strip-path", Err: fmt.Errorf("requires a single path, got %d", len(o.Paths))}
+	}
+	return nil
+}
+
+// cleanPaths returns the directories of Options.Paths relative to the repository root
+// without the redundant elements, e.g. "./cmp/" is "cmp".
+func cleanPaths(paths []string) ([]string, error) {
+	var cleaned []string
+	for _, p := range paths {
+		c := pathpkg.Clean(p)
+		if p == "" || c == "." || pathpkg.IsAbs(c) || c == ".." || strings.HasPrefix(c, "../") {
+			return nil, fmt.Errorf("path %q is not a subdirectory of the repository", p)
+		}
+		cleaned = append(cleaned, c)
+	}
+	return cleaned, nil
+}
+
+// reportedPath returns the path of the file in the file-level outputs, see Options.StripPath.
+func (o *Options) reportedPath(path string) string {
+	if !o.StripPath {
+		return path
+	}
+	if rel, ok := strings.CutPrefix(path, o.Paths[0]+"/"); ok {
+		return rel
+	}
+	return path
+}
+
+// gitOption returns the name of an option only the git command supports, if any is set.
+func (o *Options) gitOption() string {
+	switch {
+	case o.Mailmap != "":
+		return "mailmap"
+	case o.SkipBinary:
+		return "skip-binary"
+	case o.ExcludeCommitMessage != "":
+		return "exclude-commit-message"
+	case o.CommitsFrom == CommitsFromLog:
+		return "commits-from=" + CommitsFromLog
+	case o.Since != nil:
+		return "since-state"
+	}
+	return ""
+}
+
+// open returns the backend of the repository and the repository itself
+// for the options only the git command supports, nil for the other backends.
+func (o *Options) open() (git.Backend, *git.Repository, error) {
+	if o.backend != nil {
+		return o.backend, nil, nil
+	}
+
+	if o.Backend == BackendGoGit {
+		backend, err := git.OpenGoGit(o.Repository)
+		return backend, nil, err
+	}
+
+	repo := git.Open(o.Repository)
+	if o.Mailmap != "" {
+		repo = repo.WithMailmap(o.Mailmap)
+	}
+	return repo, repo, nil
+}
+
+// sortedAuthors returns the authors sorted and limited according to the options
+// and the names of the folded ones.
+func sortedAuthors(collector *stats.Collector, opts *Options) ([]Author, []string, error) {
+	authors := collector.Authors()
+	for i := range authors {
+		countLines(&authors[i], opts)
+	}
+	if err := stats.Sort(authors, opts.OrderBy); err != nil {
+		return nil, nil, err
+	}
+
+	var converted []Author
+	for _, a := range authors {
+		if a.Lines >= opts.MinLines {
+			converted = append(converted, Author(a))
+		}
+	}
+
+	if opts.Top == 0 || len(converted) <= opts.Top {
+		return converted, nil, nil
+	}
+
+	var folded []string
+	for _, a := range converted[opts.Top:] {
+		folded = append(folded, a.Name)
+	}
+	others := collector.Merge(Others, folded)
+	countLines(&others, opts)
+	return append(converted[:opts.Top], Author(others)), folded, nil
+}
+
+// countLines leaves only the lines of the counted kind in a.Lines.
+func countLines(a *stats.Author, opts *Options) {
+	// Lines of unclassified files are taken for code.
+	if !opts.Classify {
+		a.Code = 0
+		return
+	}
+
+	switch opts.Count {
+	case CountCode:
+		a.Lines = a.Code
+	case CountComments:
+		a.Lines = a.Comments
+	case CountBlank:
+		a.Lines = a.Blank
+	}
+}
+
+// newFilter returns the filter of the files and the language mapping,
+// the latter is nil if no option needs it.
+func newFilter(opts *Options, report *Report) (*filter.Filter, *languages.Mapping, error) {
+	f := &filter.Filter{Extensions: opts.Extensions}
+	if opts.StripPath {
+		f.Strip = opts.Paths[0]
+	}
+
+	if !slices.Contains(filter.Syntaxes, opts.PatternSyntax) {
+		return nil, nil, &OptionError{Option: "pattern-syntax", Err: fmt.Errorf("unknown pattern syntax %q", opts.PatternSyntax)}
+	}
+
+	var err error
+	if f.Exclude, err = filter.Compile(opts.PatternSyntax, opts.Exclude); err != nil {
+		return nil, nil, &OptionError{Option: "exclude", Err: err}
+	}
+	if f.RestrictTo, err = filter.Compile(opts.PatternSyntax, opts.RestrictTo); err != nil {
+		return nil, nil, &OptionError{Option: "restrict-to", Err: err}
+	}
+
+	if len(opts.Languages) == 0 && opts.LanguagesConfig == "" && !opts.Classify {
+		return f, nil, nil
+	}
+
+	// Malformed mappings are reported even if they are not used.
+	mapping, err := languages.LoadConfig(opts.LanguagesConfig, opts.LanguagesConfigMerge)
+	if err != nil {
+		return nil, nil, &OptionError{Option: "languages-config", Err: err}
+	}
+
+	if len(opts.Languages) > 0 {
+		extensions, unknown := mapping.Extensions(opts.Languages)
+		for _, name := range unknown {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("unknown language %q is ignored", name))
+		}
+
+		// Unknown languages impose no restrictions.
+		if len(unknown) < len(opts.Languages) {
+			f.Languages = append([]string{}, extensions...)
+		}
+	}
+
+	return f, mapping, nil
+}
+
+// addLogCommits adds the commits that modified any of the files to the state.
+func addLogCommits(ctx context.Context, repo *git.Repository, state *State, files []string, excluder *commitExcluder) error {
+	entries, err := repo.Log(ctx, state.Revision)
+	if err != nil {
+		return err
+	}
+
+	included := make(map[string]bool, len(files))
+	for _, path := range files {
+		included[path] = true
+	}
+
+	for _, e := range entries {
+		if !slices.ContainsFunc(e.Files, func(path string) bool { return included[path] }) {
+			continue
+		}
+
+		if excluder != nil {
+			excluded, err := excluder.isExcluded(e.Commit.Hash)
+			if err != nil {
+				return err
+			}
+			if excluded {
+				continue
+			}
+		}
+
+		state.addCommit(e.Commit)
+		state.LogCommits = append(state.LogCommits, e.Commit.Hash)
+	}
+
+	return nil
+}
+
+// reusableFiles returns the files of the previous state not changed since its revision.
+// The state is not reused if it was calculated with options of a different hash, see optionsHash.
+func reusableFiles(ctx context.Context, repo *git.Repository, report *Report, opts *Options, hash string) (map[string]FileState, error) {
+	since := opts.Since
+	if since == nil {
+		return nil, nil
+	}
+
+	if opts.Classify && !since.Classified {
+		report.Warnings = append(report.Warnings, "previous report does not classify lines, all files are blamed")
+		return nil, nil
+	}
+
+	if since.ExcludeCommitMessage != opts.ExcludeCommitMessage ||
+		since.ExcludeCommitMessage != "" && since.ExcludeMode != opts.ExcludeMode {
+		report.Warnings = append(report.Warnings, "previous report excludes different commits, all files are blamed")
+		return nil, nil
+	}
+
+	if since.Options != hash {
+		report.Warnings = append(report.Warnings, "previous report has different filters, language mapping or mailmap, all files are blamed")
+		return nil, nil
+	}
+
+	if _, err := repo.ResolveRevision(ctx, since.Revision); errors.Is(err, git.ErrUnknownRevision) {
+		report.Warnings = append(report.Warnings,
+			fmt.Sprintf("previous report revision %s is not found, all files are blamed", since.Revision))
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	ok, err := repo.IsAncestor(ctx, since.Revision, report.Revision)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		report.Warnings = append(report.Warnings,
+			fmt.Sprintf("previous report revision %s is not an ancestor of %s, all files are blamed", since.Revision, report.Revision))
+		return nil, nil
+	}
+
+	changed, err := repo.ChangedFiles(ctx, since.Revision, report.Revision)
+	if err != nil {
+		return nil, err
+	}
+
+	reused := make(map[string]FileState, len(since.Files))
+	for path, f := range since.Files {
+		reused[path] = f
+	}
+	for _, path := range changed {
+		// Author names depend on the mailmap.
+		if path == ".mailmap" {
+			report.Warnings = append(report.Warnings, "mailmap changed since previous report, all files are blamed")
+			return nil, nil
+		}
+		// Binary files and the blame depend on the attributes.
+		if pathpkg.Base(path) == ".gitattributes" {
+			report.Warnings = append(report.Warnings, "gitattributes changed since previous report, all files are blamed")
+			return nil, nil
+		}
+		delete(reused, path)
+	}
+
+	return reused, nil
+}
+
+type blameResult struct {
+	// lines are the lines of the file per commit that last modified them,
+	// broken down by kind if lines are classified and all code otherwise.
+	lines map[*git.Commit]stats.Lines
+	// last is the last commit that modified the file, set for empty files only.
+	last *git.Commit
+}
+
+// blameFiles blames files concurrently.
+//
+// Lines are classified with the mapping if Options.Classify is set.
+// Commits are removed from the results by excluder if it is set.
+// With Options.PartialOK only the files blamed before ctx is done are returned
+// instead of the error.
+func blameFiles(
+	ctx context.Context, backend git.Backend, rev string, files []string,
+	excluder *commitExcluder, mapping *languages.Mapping, opts *Options,
+) (map[string]*blameResult, error) {
+	results := make([]blameResult, len(files))
+	// blamed[i] is set once files[i] is blamed, written by its goroutine only.
+	blamed := make([]bool, len(files))
+
+	var mu sync.Mutex
+	completed := 0
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(runtime.NumCPU())
+
+	for i, path := range files {
+		i, path := i, path
+		g.Go(func() error {
+			if err := gctx.Err(); err != nil {
+				return err
+			}
+
+			defer func() {
+				mu.Lock()
+				defer mu.Unlock()
+				completed++
+				opts.Progress(completed, len(files))
+			}()
+
+			blame := func(ignoreRevs ...string) (map[*git.Commit]stats.Lines, error) {
+				return blameFile(gctx, backend, rev, path, mapping, opts.Classify, ignoreRevs...)
+			}
+
+			lines, err := blame()
+			if err != nil {
+				return err
+			}
+
+			results[i].lines = lines
+			if len(lines) == 0 {
+				results[i].last, err = backend.LastCommit(gctx, rev, path)
+				if err != nil {
+					return err
+				}
+			}
+
+			if excluder != nil {
+				if err := excluder.apply(gctx, path, &results[i], blame); err != nil {
+					return err
+				}
+			}
+
+			blamed[i] = true
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil && (!opts.PartialOK || ctx.Err() == nil) {
+		return nil, err
+	}
+
+	byPath := make(map[string]*blameResult, len(files))
+	for i, path := range files {
+		if blamed[i] {
+			byPath[path] = &results[i]
+		}
+	}
+	return byPath, nil
+}
+
+// blameFile counts the lines of the file per commit that last modified them as the blame is read,
+// classified with the mapping if classify is set.
+func blameFile(
+	ctx context.Context, backend git.Backend, rev, path string,
+	mapping *languages.Mapping, classify bool, ignoreRevs ...string,
+) (map[*git.Commit]stats.Lines, error) {
+	var c *languages.Classifier
+	if classify {
+		// Files of unknown languages have no comments.
+		lang, _ := mapping.ForPath(path)
+		c = languages.NewClassifier(lang)
+	}
+
+	lines := make(map[*git.Commit]stats.Lines)
+	err := backend.Blame(ctx, rev, path, func(commit *git.Commit, text string) error {
+		l := lines[commit]
+		kind := languages.Code
+		if c != nil {
+			kind = c.Classify(text)
+		}
+		switch kind {
+		case languages.Comment:
+			l.Comments++
+		case languages.Blank:
+			l.Blank++
+		default:
+			l.Code++
+		}
+		lines[commit] = l
+		return nil
+	}, ignoreRevs...)
+	if err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
@@ -0,0 +1,419 @@
+package gitfame
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const bundlesDir = "../../test/integration/testdata/bundles"
+
+func cloneBundle(t *testing.T, name string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	cmd := exec.Command("git", "clone", filepath.Join(bundlesDir, name), dir)
+	require.NoError(t, cmd.Run())
+
+	return dir
+}
+
+func TestRun(t *testing.T) {
+	dir := cloneBundle(t, "simple.bundle")
+
+	report, err := Run(context.Background(), Options{
+		Repository: dir,
+		Revision:   "v1.0",
+		Languages:  []string{"markdown", "klingon"},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, report.Revision, 40)
+	require.Equal(t, []Author{
+		{Name: "Rob Pike", Lines: 5, Commits: 2, Files: 2},
+	}, report.Authors)
+	require.Equal(t, []string{`unknown language "klingon" is ignored`}, report.Warnings)
+
+	w, err := NewWriter(FormatCSV)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, w.Write(&out, report))
+	require.Equal(t, "Name,Lines,Commits,Files\nRob Pike,5,2,2\n", out.String())
+}
+
+func TestRunErrors(t *testing.T) {
+	dir := cloneBundle(t, "simple.bundle")
+
+	for _, tc := range []struct {
+		name string
+		opts Options
+	}{
+		{name: "bad revision", opts: Options{Revision: "H3AD"}},
+		{name: "bad order", opts: Options{OrderBy: "time"}},
+		{name: "bad pattern syntax", opts: Options{PatternSyntax: "regexp"}},
+		{name: "bad languages config", opts: Options{LanguagesConfig: "missing.json"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.opts.Repository = dir
+			_, err := Run(context.Background(), tc.opts)
+			require.Error(t, err)
+		})
+	}
+
+	_, err := NewWriter("yson")
+	require.Error(t, err)
+
+	_, err = Run(context.Background(), Options{Repository: dir, OrderBy: "time"})
+	var optionErr *OptionError
+	require.ErrorAs(t, err, &optionErr)
+	require.Equal(t, "order-by", optionErr.Option)
+	require.ErrorIs(t, err, ErrInvalidOptions)
+
+	_, err = Run(context.Background(), Options{Repository: dir, Revision: "H3AD"})
+	require.ErrorIs(t, err, ErrUnknownRevision)
+
+	_, err = Run(context.Background(), Options{Repository: t.TempDir()})
+	require.ErrorIs(t, err, ErrRepositoryNotFound)
+}
+
+func TestRunSince(t *testing.T) {
+	dir := cloneBundle(t, "go-cmp.bundle")
+	ctx := context.Background()
+
+	full, err := Run(ctx, Options{Repository: dir})
+	require.NoError(t, err)
+
+	for _, since := range []string{"HEAD~20", "HEAD~60", "HEAD"} {
+		t.Run(since, func(t *testing.T) {
+			prev, err := Run(ctx, Options{Repository: dir, Revision: since, UseCommitter: true})
+			require.NoError(t, err)
+
+			// The state survives serialization.
+			var buf bytes.Buffer
+			require.NoError(t, prev.State.Write(&buf))
+			state, err := ParseState(&buf)
+			require.NoError(t, err)
+			require.Equal(t, prev.State, state)
+
+			var blamed int
+			report, err := Run(ctx, Options{
+				Repository: dir,
+				Since:      state,
+				Progress:   func(done, total int) { blamed = total },
+			})
+			require.NoError(t, err)
+			require.Equal(t, full.Authors, report.Authors)
+			require.Equal(t, full.State, report.State)
+			require.Less(t, blamed, len(full.State.Files))
+			require.Empty(t, report.Warnings)
+		})
+	}
+
+	t.Run("old version", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, full.State.Write(&buf))
+		_, err := ParseState(strings.NewReader(strings.Replace(buf.String(), `"version":2`, `"version":1`, 1)))
+		require.ErrorContains(t, err, "unsupported state version 1")
+	})
+
+	t.Run("not an ancestor", func(t *testing.T) {
+		report, err := Run(ctx, Options{Repository: dir, Revision: "HEAD~10", Since: full.State})
+		require.NoError(t, err)
+		require.Len(t, report.Warnings, 1)
+
+		expected, err := Run(ctx, Options{Repository: dir, Revision: "HEAD~10"})
+		require.NoError(t, err)
+		require.Equal(t, expected.Authors, report.Authors)
+	})
+
+	t.Run("different options", func(t *testing.T) {
+		config := filepath.Join(t.TempDir(), "languages.json")
+		require.NoError(t, os.WriteFile(config, []byte(`[{"name": "Go", "extensions": [".go"]}]`), 0o644))
+
+		opts := Options{Repository: dir, Languages: []string{"go"}, LanguagesConfig: config}
+		expected, err := Run(ctx, opts)
+		require.NoError(t, err)
+
+		for _, prev := range []Options{
+			{Repository: dir, Revision: "HEAD~20", Exclude: []string{"*.md"}},
+			{Repository: dir, Revision: "HEAD~20", Languages: []string{"go"}},
+		} {
+			prev, err := Run(ctx, prev)
+			require.NoError(t, err)
+
+			opts.Since = prev.State
+			report, err := Run(ctx, opts)
+			require.NoError(t, err)
+			require.Len(t, report.Warnings, 1)
+			require.Equal(t, expected.Authors, report.Authors)
+		}
+	})
+}
+
+func TestRunRepositories(t *testing.T) {
+	dir := cloneBundle(t, "simple.bundle")
+	ctx := context.Background()
+
+	manifest := filepath.Join(t.TempDir(), "manifest")
+	require.NoError(t, os.WriteFile(manifest, []byte("# simple twice\n"+dir+" v1.0\n\n"+dir+"\tHEAD~1\n"), 0o644))
+
+	sources, err := ReadManifest(manifest)
+	require.NoError(t, err)
+	require.Equal(t, []Source{
+		{Name: dir, Path: dir, Revision: "v1.0"},
+		{Name: dir, Path: dir, Revision: "HEAD~1"},
+	}, sources)
+
+	sources[0].Name = "v1"
+	report, err := RunRepositories(ctx, sources, Options{Languages: []string{"klingon"}})
+	require.NoError(t, err)
+
+	// Commits are shared, files are not.
+	require.Equal(t, []Author{
+		{Name: "Rob Pike", Lines: 19, Commits: 3, Files: 5},
+		{Name: "Brad Fitzpatrick", Lines: 2, Commits: 1, Files: 2},
+	}, report.Authors)
+	require.Equal(t, []string{`unknown language "klingon" is ignored`}, report.Warnings)
+	require.Empty(t, report.Revision)
+	require.Nil(t, report.State)
+
+	w, err := NewRepositoriesWriter(FormatCSV)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, w.Write(&out, report))
+	require.Equal(t, "Repository,Name,Lines,Commits,Files\n"+
+		"v1,Rob Pike,12,3,3\n"+
+		"v1,Brad Fitzpatrick,1,1,1\n"+
+		dir+",Rob Pike,7,2,2\n"+
+		dir+",Brad Fitzpatrick,1,1,1\n", out.String())
+
+	single, err := RunRepositories(ctx, sources[:1], Options{})
+	require.NoError(t, err)
+	require.Len(t, single.Revision, 40)
+	require.NotNil(t, single.State)
+
+	_, err = RunRepositories(ctx, nil, Options{})
+	require.ErrorIs(t, err, ErrInvalidOptions)
+
+	_, err = RunRepositories(ctx, sources, Options{Since: single.State})
+	require.ErrorIs(t, err, ErrInvalidOptions)
+
+	require.NoError(t, os.WriteFile(manifest, []byte(dir+" v1.0 extra\n"), 0o644))
+	_, err = ReadManifest(manifest)
+	require.Error(t, err)
+}
+
+func TestRunExcludeCommitMessage(t *testing.T) {
+	dir := cloneBundle(t, "simple.bundle")
+	ctx := context.Background()
+
+	opts := Options{Repository: dir, Revision: "138c454", ExcludeCommitMessage: "clear docs"}
+	report, err := Run(ctx, opts)
+	require.NoError(t, err)
+	require.Equal(t, []Author{
+		{Name: "Rob Pike", Lines: 7, Commits: 1, Files: 1},
+		{Name: "Brad Fitzpatrick", Lines: 1, Commits: 1, Files: 1},
+		{Name: "Rober Griesemer", Lines: 0, Commits: 1, Files: 1},
+	}, report.Authors)
+
+	// The state of a run with other exclusions can not be reused.
+	opts.ExcludeMode = ExcludeModeDrop
+	opts.Since = report.State
+	report, err = Run(ctx, opts)
+	require.NoError(t, err)
+	require.Equal(t, []Author{
+		{Name: "Rob Pike", Lines: 6, Commits: 1, Files: 1},
+		{Name: "Brad Fitzpatrick", Lines: 1, Commits: 1, Files: 1},
+	}, report.Authors)
+	require.Len(t, report.Warnings, 1)
+}
+
+func TestRunCount(t *testing.T) {
+	dir := cloneBundle(t, "go-cmp.bundle")
+	ctx := context.Background()
+
+	all, err := Run(ctx, Options{Repository: dir, Classify: true})
+	require.NoError(t, err)
+	require.True(t, all.State.Classified)
+
+	var comments int
+	for _, a := range all.Authors {
+		require.Equal(t, a.Lines, a.Code+a.Comments+a.Blank, a.Name)
+		comments += a.Comments
+	}
+	require.NotZero(t, comments)
+
+	code, err := Run(ctx, Options{Repository: dir, Count: CountCode})
+	require.NoError(t, err)
+	for _, a := range code.Authors {
+		require.Equal(t, a.Code, a.Lines, a.Name)
+	}
+
+	prev, err := Run(ctx, Options{Repository: dir, Revision: "HEAD~20", Count: CountComments})
+	require.NoError(t, err)
+	report, err := Run(ctx, Options{Repository: dir, Count: CountCode, Since: prev.State})
+	require.NoError(t, err)
+	require.Empty(t, report.Warnings)
+	require.Equal(t, code.Authors, report.Authors)
+
+	unclassified, err := Run(ctx, Options{Repository: dir, Revision: "HEAD~20"})
+	require.NoError(t, err)
+	report, err = Run(ctx, Options{Repository: dir, Count: CountCode, Since: unclassified.State})
+	require.NoError(t, err)
+	require.Len(t, report.Warnings, 1)
+	require.Equal(t, code.Authors, report.Authors)
+}
+
+func TestRunSkip(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"blob.bin":       "a\x00b\n",
+		"data.dat":       "x\ny\n",
+		".gitattributes": "*.dat binary\n",
+		"big.txt":        strings.Repeat("line\n", 300),
+		"empty":          "",
+		// Git looks for NUL bytes only in the first 8000 bytes.
+		"late.bin": strings.Repeat("x", 9000) + "\x00\n",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644))
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "."},
+		{"-c", "user.name=Alice", "-c", "user.email=alice@example.com", "commit", "-q", "-m", "init"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		require.NoError(t, cmd.Run())
+	}
+
+	report, err := Run(context.Background(), Options{Repository: dir, MaxFileSize: 1024, SkipBinary: true})
+	require.NoError(t, err)
+	require.Equal(t, []Author{{Name: "Alice", Lines: 1, Commits: 1, Files: 2}}, report.Authors)
+
+	var skipped []string
+	for _, f := range report.Skipped {
+		skipped = append(skipped, f.Path)
+	}
+	require.ElementsMatch(t, []string{"big.txt", "blob.bin", "data.dat", "late.bin"}, skipped)
+
+	report, err = Run(context.Background(), Options{Repository: dir, SkipBinary: true})
+	require.NoError(t, err)
+	require.Equal(t, []Author{{Name: "Alice", Lines: 302, Commits: 1, Files: 4}}, report.Authors)
+	require.Len(t, report.Skipped, 2)
+}
+
+func TestParseSize(t *testing.T) {
+	for s, n := range map[string]int64{"0": 0, "100": 100, "512k": 512 << 10, "2MiB": 2 << 20, "1G": 1 << 30, "3KB": 3 << 10} {
+		size, err := ParseSize(s)
+		require.NoError(t, err, s)
+		require.Equal(t, n, size, s)
+	}
+	for _, s := range []string{"", "k", "-1", "1t", "1.5m"} {
+		_, err := ParseSize(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestRunPartial(t *testing.T) {
+	dir := cloneBundle(t, "go-cmp.bundle")
+
+	run := func(partialOK bool) (*Report, error) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		return Run(ctx, Options{
+			Repository: dir,
+			PartialOK:  partialOK,
+			// Interrupt the run once the first file is blamed.
+			Progress: func(done, total int) { cancel() },
+		})
+	}
+
+	_, err := run(false)
+	require.ErrorIs(t, err, context.Canceled)
+
+	report, err := run(true)
+	require.NoError(t, err)
+	require.True(t, report.Partial)
+	require.NotEmpty(t, report.State.Files)
+	require.NotEmpty(t, report.Authors)
+	require.Len(t, report.Warnings, 1)
+	require.Contains(t, report.Warnings[0], "partial results")
+
+	full, err := Run(context.Background(), Options{Repository: dir})
+	require.NoError(t, err)
+	require.Less(t, len(report.State.Files), len(full.State.Files))
+
+	// The state of the partial report is completed incrementally.
+	report, err = Run(context.Background(), Options{Repository: dir, Since: report.State})
+	require.NoError(t, err)
+	require.False(t, report.Partial)
+	require.Equal(t, full.Authors, report.Authors)
+}
+
+func TestRunGoGit(t *testing.T) {
+	dir := cloneBundle(t, "breaker.bundle")
+
+	cli, err := Run(context.Background(), Options{Repository: dir})
+	require.NoError(t, err)
+
+	gogit, err := Run(context.Background(), Options{Repository: dir, Backend: BackendGoGit})
+	require.NoError(t, err)
+	require.Equal(t, cli.Revision, gogit.Revision)
+	require.Equal(t, cli.Authors, gogit.Authors)
+
+	_, err = Run(context.Background(), Options{Repository: dir, Backend: BackendGoGit, CommitsFrom: CommitsFromLog})
+	var optionErr *OptionError
+	require.ErrorAs(t, err, &optionErr)
+	require.Equal(t, "backend", optionErr.Option)
+}
+
+func TestRunPaths(t *testing.T) {
+	dir := cloneBundle(t, "go-cmp.bundle")
+	ctx := context.Background()
+
+	full, err := Run(ctx, Options{Repository: dir, RestrictTo: []string{"cmp/internal/*/*.go"}})
+	require.NoError(t, err)
+
+	// Patterns match the paths relative to the subtree.
+	stripped, err := Run(ctx, Options{
+		Repository:  dir,
+		Paths:       []string{"./cmp/internal/"},
+		StripPath:   true,
+		RestrictTo:  []string{"*/*.go"},
+		MaxFileSize: 12 << 10,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []SkippedFile{
+		{Path: "diff/diff.go", Reason: "size of 13101 bytes exceeds the limit of 12288 bytes"},
+	}, stripped.Skipped)
+
+	skipped, err := Run(ctx, Options{Repository: dir, RestrictTo: []string{"cmp/internal/*/*.go"}, Exclude: []string{"cmp/internal/diff/diff.go"}})
+	require.NoError(t, err)
+	require.Equal(t, skipped.Authors, stripped.Authors)
+	require.NotEqual(t, full.Authors, stripped.Authors)
+
+	report, err := Run(ctx, Options{Repository: dir, Paths: []string{"cmp/internal", "missing"}})
+	require.NoError(t, err)
+	require.Equal(t, []string{`path "missing" matches no files`}, report.Warnings)
+	require.Equal(t, 25, report.Authors[0].Files)
+
+	for _, opts := range []Options{
+		{Paths: []string{"../cmp"}},
+		{Paths: []string{"cmp", "."}},
+		{Paths: []string{"cmp", "cmpopts"}, StripPath: true},
+	} {
+		opts.Repository = dir
+		_, err := Run(ctx, opts)
+		require.ErrorIs(t, err, ErrInvalidOptions)
+	}
+}
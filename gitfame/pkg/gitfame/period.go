@@ -0,0 +1,73 @@
+package gitfame
+
+import (
+	"fmt"
+	"time"
+)
+
+// Periods the history is divided into, in UTC.
+const (
+	PeriodWeek    = "week"
+	PeriodMonth   = "month"
+	PeriodQuarter = "quarter"
+	PeriodYear    = "year"
+)
+
+// periodStart returns the start of the period containing t, weeks start on Monday.
+func periodStart(t time.Time, period string) time.Time {
+	t = t.UTC()
+	switch period {
+	case PeriodWeek:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case PeriodMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case PeriodQuarter:
+		return time.Date(t.Year(), t.Month()-(t.Month()-1)%3, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// nextPeriod returns the start of the period following the one starting at start.
+func nextPeriod(start time.Time, period string) time.Time {
+	switch period {
+	case PeriodWeek:
+		return start.AddDate(0, 0, 7)
+	case PeriodMonth:
+		return start.AddDate(0, 1, 0)
+	case PeriodQuarter:
+		return start.AddDate(0, 3, 0)
+	default:
+		return start.AddDate(1, 0, 0)
+	}
+}
+
+// periodLabel names the period starting at start, e.g. 2021-W09, 2021-03, 2021-Q1 or 2021.
+func periodLabel(start time.Time, period string) string {
+	switch period {
+	case PeriodWeek:
+		year, week := start.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case PeriodMonth:
+		return start.Format("2006-01")
+	case PeriodQuarter:
+		return fmt.Sprintf("%d-Q%d", start.Year(), (start.Month()+2)/3)
+	default:
+		return start.Format("2006")
+	}
+}
+
+// periodUnit is the suffix of a number of the periods, e.g. 3q for three quarters.
+func periodUnit(period string) string {
+	return period[:1]
+}
+
+// periods returns the starts of the periods from the one containing from to the one containing to.
+func periods(from, to time.Time, period string) []time.Time {
+	var starts []time.Time
+	for start := periodStart(from, period); !start.After(to); start = nextPeriod(start, period) {
+		starts = append(starts, start)
+	}
+	return starts
+}
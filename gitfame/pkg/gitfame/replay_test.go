@@ -0,0 +1,157 @@
+package gitfame
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/gitfame/internal/git"
+)
+
+var record = flag.Bool("record", false, "record the replay fixtures from the bundles, needs git")
+
+// recorded are the fixtures recorded by this run of the tests.
+var recorded = make(map[string]bool)
+
+// replay returns the backend serving the fixture of the bundle recorded at the revision.
+func replay(t *testing.T, bundle, rev string) git.Backend {
+	t.Helper()
+
+	path := filepath.Join("testdata", "replay", strings.TrimSuffix(bundle, ".bundle")+".json")
+	if *record && !recorded[path] {
+		recordFixture(t, bundle, rev, path)
+		recorded[path] = true
+	}
+
+	backend, err := git.OpenReplay(path)
+	require.NoError(t, err)
+	return backend
+}
+
+// recordFixture records the blame of all files of the revision, the revision commit
+// read by RunAge and a lookup of an unknown revision.
+func recordFixture(t *testing.T, bundle, rev, path string) {
+	t.Helper()
+
+	recorder := git.NewRecorder(git.Open(cloneBundle(t, bundle)))
+
+	_, err := RunAge(context.Background(), Options{Revision: rev, backend: recorder}, AgeOptions{})
+	require.NoError(t, err)
+	_, err = recorder.ResolveRevision(context.Background(), "H3AD")
+	require.ErrorIs(t, err, git.ErrUnknownRevision)
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, recorder.Save(path))
+}
+
+func TestReplay(t *testing.T) {
+	const tabby = "My\tname\tis\tTabby"
+	const odd = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUV\tWXYZ!\"#$%&'()*+,-./:;=?@[\\]^_`{|}~"
+
+	for _, tc := range []struct {
+		name    string
+		bundle  string
+		opts    Options
+		authors []Author
+	}{
+		{
+			name:   "all files",
+			bundle: "breaker.bundle",
+			opts:   Options{Revision: "HEAD"},
+			authors: []Author{
+				{Name: tabby, Lines: 7, Commits: 2, Files: 2},
+				{Name: "Brad Fitzpatrick", Lines: 4, Commits: 1, Files: 1},
+				{Name: odd, Lines: 0, Commits: 1, Files: 1},
+			},
+		},
+		{
+			name:   "extensions",
+			bundle: "breaker.bundle",
+			opts:   Options{Revision: "HEAD", Extensions: []string{".go", ".md"}},
+			authors: []Author{
+				{Name: tabby, Lines: 7, Commits: 1, Files: 1},
+				{Name: "Brad Fitzpatrick", Lines: 4, Commits: 1, Files: 1},
+			},
+		},
+		{
+			name:   "exclude and top",
+			bundle: "breaker.bundle",
+			opts:   Options{Revision: "HEAD", Exclude: []string{"*.md"}, Top: 1},
+			authors: []Author{
+				{Name: tabby, Lines: 7, Commits: 2, Files: 2},
+				{Name: Others, Lines: 0, Commits: 1, Files: 1},
+			},
+		},
+		{
+			name:   "order by name",
+			bundle: "simple.bundle",
+			opts:   Options{Revision: "v1.0", OrderBy: "name"},
+			authors: []Author{
+				{Name: "Brad Fitzpatrick", Lines: 1, Commits: 1, Files: 1},
+				{Name: "Rob Pike", Lines: 12, Commits: 3, Files: 3},
+			},
+		},
+		{
+			name:    "languages and min lines",
+			bundle:  "simple.bundle",
+			opts:    Options{Revision: "v1.0", Languages: []string{"go"}, MinLines: 2},
+			authors: []Author{{Name: "Rob Pike", Lines: 7, Commits: 2, Files: 1}},
+		},
+		{
+			name:   "count comments",
+			bundle: "simple.bundle",
+			opts:   Options{Revision: "v1.0", RestrictTo: []string{"*.go"}, Count: CountComments},
+			authors: []Author{
+				{Name: "Rob Pike", Lines: 0, Commits: 2, Files: 1, Code: 5, Blank: 2},
+				{Name: "Brad Fitzpatrick", Lines: 0, Commits: 1, Files: 1, Code: 1},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.opts.backend = replay(t, tc.bundle, tc.opts.Revision)
+
+			report, err := Run(context.Background(), tc.opts)
+			require.NoError(t, err)
+			require.Len(t, report.Revision, 40)
+			require.Equal(t, tc.authors, report.Authors)
+		})
+	}
+}
+
+func TestReplayWriters(t *testing.T) {
+	report, err := Run(context.Background(), Options{Revision: "v1.0", backend: replay(t, "simple.bundle", "v1.0")})
+	require.NoError(t, err)
+
+	for format, expected := range map[string]string{
+		FormatCSV:       "Name,Lines,Commits,Files\nRob Pike,12,3,3\nBrad Fitzpatrick,1,1,1\n",
+		FormatJSONLines: "{\"name\":\"Rob Pike\",\"lines\":12,\"commits\":3,\"files\":3}\n{\"name\":\"Brad Fitzpatrick\",\"lines\":1,\"commits\":1,\"files\":1}\n",
+	} {
+		w, err := NewWriter(format)
+		require.NoError(t, err)
+
+		var out bytes.Buffer
+		require.NoError(t, w.Write(&out, report))
+		require.Equal(t, expected, out.String(), format)
+	}
+}
+
+func TestReplayErrors(t *testing.T) {
+	backend := replay(t, "simple.bundle", "v1.0")
+
+	_, err := Run(context.Background(), Options{Revision: "H3AD", backend: backend})
+	require.ErrorIs(t, err, ErrUnknownRevision)
+
+	_, err = Run(context.Background(), Options{Revision: "HEAD~1", backend: backend})
+	require.ErrorIs(t, err, git.ErrNotRecorded)
+
+	_, err = Run(context.Background(), Options{Revision: "v1.0", SkipBinary: true, backend: backend})
+	var optionErr *OptionError
+	require.ErrorAs(t, err, &optionErr)
+	require.Equal(t, "backend", optionErr.Option)
+}
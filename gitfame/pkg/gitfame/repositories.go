@@ -0,0 +1,154 @@
+package gitfame
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gitlab.com/slon/shad-go/gitfame/internal/stats"
+)
+
+// Source is a repository analyzed by RunRepositories.
+type Source struct {
+	// Name identifies the repository in the report, Path by default.
+	Name string
+	// Path is the path to the repository.
+	Path string
+	// Revision overrides Options.Revision if set.
+	Revision string
+}
+
+// RepositoryReport is the report of a single repository.
+type RepositoryReport struct {
+	Name string
+	*Report
+}
+
+// RunRepositories analyzes each repository with the same options and merges
+// the authors into a single report.
+//
+// Authors are merged by Options.GroupBy, by name by default. Commits are counted once even if they are shared
+// by several repositories, files of different repositories are always distinct.
+// The merged report has Revision and State set only for a single repository,
+// its Skipped files are the ones of all repositories.
+func RunRepositories(ctx context.Context, sources []Source, opts Options) (*Report, error) {
+	opts.setDefaults()
+
+	if len(sources) == 0 {
+		return nil, &OptionError{Option: "repository", Err: errors.New("no repositories")}
+	}
+	if len(sources) > 1 && opts.Since != nil {
+		return nil, &OptionError{Option: "since-state", Err: errors.New("previous state can not be used with several repositories")}
+	}
+
+	merged := &Report{CommitsFrom: opts.CommitsFrom, Count: opts.Count, UseCommitter: opts.UseCommitter, GroupBy: opts.GroupBy}
+	if opts.StripPath && len(opts.Paths) == 1 {
+		merged.StripPrefix = opts.Paths[0] + "/"
+	}
+	collector := stats.NewCollector(opts.UseCommitter, opts.CommitsFrom == CommitsFromLog)
+	warnings := make(map[string]struct{})
+
+	for i, src := range sources {
+		o := opts
+		o.Repository = src.Path
+		if src.Revision != "" {
+			o.Revision = src.Revision
+		}
+
+		name := src.Name
+		if name == "" {
+			name = src.Path
+		}
+
+		report, err := Run(ctx, o)
+		if err != nil && opts.PartialOK && ctx.Err() != nil && len(merged.Repositories) > 0 {
+			// The repositories analyzed so far make the partial report.
+			merged.Partial = true
+			merged.Warnings = append(merged.Warnings,
+				fmt.Sprintf("partial results: %d of %d repositories analyzed before the run was interrupted", len(merged.Repositories), len(sources)))
+			break
+		}
+		if err != nil {
+			if len(sources) == 1 {
+				return nil, err
+			}
+			return nil, fmt.Errorf("repository %s: %w", name, err)
+		}
+
+		merged.Repositories = append(merged.Repositories, RepositoryReport{Name: name, Report: report})
+		merged.Partial = merged.Partial || report.Partial
+		merged.Skipped = append(merged.Skipped, report.Skipped...)
+
+		// Options are shared, so are most of the warnings.
+		for _, w := range report.Warnings {
+			if _, ok := warnings[w]; !ok {
+				warnings[w] = struct{}{}
+				merged.Warnings = append(merged.Warnings, w)
+			}
+		}
+
+		report.State.addTo(collector, strconv.Itoa(i)+"/", opts.GroupBy)
+	}
+
+	if len(sources) == 1 {
+		merged.Revision = merged.Repositories[0].Revision
+		merged.State = merged.Repositories[0].State
+	}
+
+	var err error
+	merged.Authors, merged.Folded, err = sortedAuthors(collector, &opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return merged, nil
+}
+
+// ReadManifest reads the list of repositories from the file.
+//
+// Every line holds the path to the repository optionally followed by the revision,
+// separated by whitespace. Blank lines and lines starting with # are skipped.
+// Relative paths are relative to the directory of the manifest.
+func ReadManifest(path string) ([]Source, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var sources []Source
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("%s:%d: expected path and optional revision", path, n)
+		}
+
+		src := Source{Name: fields[0], Path: fields[0]}
+		if !filepath.IsAbs(src.Path) {
+			src.Path = filepath.Join(filepath.Dir(path), src.Path)
+		}
+		if len(fields) == 2 {
+			src.Revision = fields[1]
+		}
+		sources = append(sources, src)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(sources) == 0 {
+		return nil, errors.New(path + ": no repositories")
+	}
+	return sources, nil
+}
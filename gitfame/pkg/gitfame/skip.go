@@ -0,0 +1,123 @@
+package gitfame
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gitlab.com/slon/shad-go/gitfame/internal/git"
+)
+
+// SkippedFile is a selected file excluded from blame, see Options.MaxFileSize and Options.SkipBinary.
+type SkippedFile struct {
+	Path   string
+	Reason string
+}
+
+// skipFiles returns paths of the files to blame and the skipped ones.
+//
+// Empty files are never skipped.
+func skipFiles(ctx context.Context, repo *git.Repository, rev string, files []git.File, opts *Options) ([]string, []SkippedFile, error) {
+	var kept []git.File
+	var skipped []SkippedFile
+	for _, f := range files {
+		if opts.MaxFileSize > 0 && f.Size > opts.MaxFileSize {
+			skipped = append(skipped, SkippedFile{
+				Path:   f.Path,
+				Reason: fmt.Sprintf("size of %d bytes exceeds the limit of %d bytes", f.Size, opts.MaxFileSize),
+			})
+			continue
+		}
+		kept = append(kept, f)
+	}
+
+	if opts.SkipBinary {
+		var err error
+		kept, skipped, err = skipBinaryFiles(ctx, repo, rev, kept, skipped)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	paths := make([]string, 0, len(kept))
+	for _, f := range kept {
+		paths = append(paths, f.Path)
+	}
+	return paths, skipped, nil
+}
+
+// skipBinaryFiles moves files git does not diff as text to skipped: the ones
+// with the diff attribute unset, e.g. by the binary macro, and the ones with
+// NUL bytes.
+func skipBinaryFiles(
+	ctx context.Context, repo *git.Repository, rev string, files []git.File, skipped []SkippedFile,
+) ([]git.File, []SkippedFile, error) {
+	paths := make([]string, 0, len(files))
+	for _, f := range files {
+		paths = append(paths, f.Path)
+	}
+
+	diff, err := repo.Attributes(ctx, rev, "diff", paths)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	objects := repo.NewObjectReader(ctx)
+	defer func() { _ = objects.Close() }()
+
+	var kept []git.File
+	for _, f := range files {
+		if f.Size == 0 {
+			kept = append(kept, f)
+			continue
+		}
+
+		if diff[f.Path] == git.AttributeUnset {
+			skipped = append(skipped, SkippedFile{Path: f.Path, Reason: "binary: diff attribute is unset"})
+			continue
+		}
+
+		// Only the prefix git looks at is read, binary files may be large.
+		_, data, err := objects.ReadPrefix(f.Object, git.BinarySniffSize)
+		if err != nil {
+			return nil, nil, err
+		}
+		if git.IsBinary(data) {
+			skipped = append(skipped, SkippedFile{Path: f.Path, Reason: "binary: contains NUL bytes"})
+			continue
+		}
+
+		kept = append(kept, f)
+	}
+
+	return kept, skipped, nil
+}
+
+// ParseSize parses a size in bytes with an optional binary suffix:
+// k or K for KiB, m or M for MiB, g or G for GiB, e.g. "512k".
+// The suffix may be followed by "B" or "iB".
+func ParseSize(s string) (int64, error) {
+	number := strings.TrimRightFunc(s, unicode.IsLetter)
+	suffix := strings.TrimSuffix(strings.TrimSuffix(s[len(number):], "B"), "i")
+
+	var unit int64 = 1
+	switch strings.ToLower(suffix) {
+	case "":
+	case "k":
+		unit = 1 << 10
+	case "m":
+		unit = 1 << 20
+	case "g":
+		unit = 1 << 30
+	default:
+		return 0, fmt.Errorf("malformed size %q", s)
+	}
+
+	n, err := strconv.ParseInt(strings.TrimSpace(number), 10, 64)
+	if err != nil || n < 0 || n > (1<<63-1)/unit {
+		return 0, fmt.Errorf("malformed size %q", s)
+	}
+	return n * unit, nil
+}
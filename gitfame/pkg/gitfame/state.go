@@ -0,0 +1,333 @@
+package gitfame
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gitlab.com/slon/shad-go/gitfame/internal/git"
+	"gitlab.com/slon/shad-go/gitfame/internal/languages"
+	"gitlab.com/slon/shad-go/gitfame/internal/stats"
+)
+
+// stateVersion is 2 since the commits hold their times, older states are rejected
+// for their commits would count as written at the epoch.
+const stateVersion = 2
+
+// State is the per-file attribution behind a report.
+//
+// Passing the State of a previous report in Options.Since makes Run blame
+// only the files changed since its revision.
+type State struct {
+	Version int `json:"version"`
+	// Revision is the hash of the analyzed commit.
+	Revision string `json:"revision"`
+	// Commits maps hashes of the attributed commits to their authors.
+	Commits map[string]StateCommit `json:"commits"`
+	// Files maps paths of the analyzed files to their attribution.
+	Files map[string]FileState `json:"files"`
+	// LogCommits are hashes of the commits counted with CommitsFromLog.
+	LogCommits []string `json:"log_commits,omitempty"`
+	// Classified is set if files break their lines down by kind, see Options.Classify.
+	Classified bool `json:"classified,omitempty"`
+
+	// ExcludeCommitMessage and ExcludeMode are the options the attribution depends on.
+	ExcludeCommitMessage string `json:"exclude_commit_message,omitempty"`
+	ExcludeMode          string `json:"exclude_mode,omitempty"`
+	// Options is a hash of the filters, the language mapping and the mailmap the state
+	// was calculated with. States with different hashes are not reused.
+	Options string `json:"options,omitempty"`
+}
+
+// StateCommit holds names and emails of the author and the committer of a commit and the times of the commit.
+type StateCommit struct {
+	Author    string `json:"author"`
+	Committer string `json:"committer"`
+	// AuthorMail and CommitterMail are unset in the states written before they were added.
+	AuthorMail    string `json:"author_mail,omitempty"`
+	CommitterMail string `json:"committer_mail,omitempty"`
+	// AuthorTime and CommitterTime are unix timestamps, set for every commit.
+	AuthorTime    int64 `json:"author_time,omitempty"`
+	CommitterTime int64 `json:"committer_time,omitempty"`
+}
+
+// name returns the key of the author, or of the committer if committer is set, see Options.GroupBy.
+func (c StateCommit) name(committer bool, groupBy string) string {
+	name, mail := c.Author, c.AuthorMail
+	if committer {
+		name, mail = c.Committer, c.CommitterMail
+	}
+	if mail == "" {
+		return name
+	}
+
+	switch groupBy {
+	case GroupByEmail:
+		return strings.ToLower(mail)
+	case GroupByDomain:
+		if i := strings.LastIndexByte(mail, '@'); i >= 0 {
+			return strings.ToLower(mail[i+1:])
+		}
+		return strings.ToLower(mail)
+	default:
+		return name
+	}
+}
+
+// FileState is the attribution of a single file.
+//
+// Files with all lines excluded have neither Lines nor Last set.
+type FileState struct {
+	// Lines maps commit hashes to the number of lines they last modified.
+	Lines map[string]int `json:"lines,omitempty"`
+	// Comments and Blank map commit hashes to the number of comment and blank lines
+	// among the Lines, set if the State is Classified. The rest of the lines are code.
+	Comments map[string]int `json:"comments,omitempty"`
+	Blank    map[string]int `json:"blank,omitempty"`
+	// Last is the hash of the last commit that modified the file, set for empty files only.
+	Last string `json:"last,omitempty"`
+}
+
+func newState(revision string, opts *Options, hash string) *State {
+	s := &State{
+		Version:    stateVersion,
+		Revision:   revision,
+		Options:    hash,
+		Commits:    make(map[string]StateCommit),
+		Files:      make(map[string]FileState),
+		Classified: opts.Classify,
+	}
+	if opts.ExcludeCommitMessage != "" {
+		s.ExcludeCommitMessage = opts.ExcludeCommitMessage
+		s.ExcludeMode = opts.ExcludeMode
+	}
+	return s
+}
+
+// optionsHash returns State.Options of the options and the language mapping, nil if it is not loaded.
+func optionsHash(opts *Options, mapping *languages.Mapping) (string, error) {
+	var mailmap []byte
+	if opts.Mailmap != "" {
+		var err error
+		if mailmap, err = os.ReadFile(opts.Mailmap); err != nil {
+			return "", &OptionError{Option: "mailmap", Err: err}
+		}
+	}
+
+	var langs []languages.Language
+	if mapping != nil {
+		langs = mapping.Languages()
+	}
+
+	data, err := json.Marshal([]interface{}{
+		opts.Extensions,
+		opts.Languages,
+		langs,
+		opts.Exclude,
+		opts.RestrictTo,
+		opts.PatternSyntax,
+		opts.Paths,
+		opts.StripPath,
+		opts.MaxFileSize,
+		opts.SkipBinary,
+		mailmap,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (s *State) addCommit(c *git.Commit) {
+	s.Commits[c.Hash] = StateCommit{
+		Author:        c.Author,
+		Committer:     c.Committer,
+		AuthorMail:    c.AuthorMail,
+		CommitterMail: c.CommitterMail,
+		AuthorTime:    c.AuthorTime.Unix(),
+		CommitterTime: c.CommitterTime.Unix(),
+	}
+}
+
+func (s *State) addResult(path string, r *blameResult) {
+	if r.last != nil {
+		s.addCommit(r.last)
+		s.Files[path] = FileState{Last: r.last.Hash}
+		return
+	}
+
+	var f FileState
+	if len(r.lines) > 0 {
+		f.Lines = make(map[string]int)
+	}
+	for c, l := range r.lines {
+		s.addCommit(c)
+		f.Lines[c.Hash] += l.Total()
+
+		if !s.Classified {
+			continue
+		}
+		if l.Comments > 0 {
+			f.Comments = add(f.Comments, c.Hash, l.Comments)
+		}
+		if l.Blank > 0 {
+			f.Blank = add(f.Blank, c.Hash, l.Blank)
+		}
+	}
+	s.Files[path] = f
+}
+
+func add(m map[string]int, key string, n int) map[string]int {
+	if m == nil {
+		m = make(map[string]int)
+	}
+	m[key] += n
+	return m
+}
+
+func (s *State) addFile(path string, f FileState, commits map[string]StateCommit) {
+	if !s.Classified {
+		f.Comments, f.Blank = nil, nil
+	}
+	for hash := range f.Lines {
+		s.Commits[hash] = commits[hash]
+	}
+	if f.Last != "" {
+		s.Commits[f.Last] = commits[f.Last]
+	}
+	s.Files[path] = f
+}
+
+// addTo accounts all files of the state, prefix distinguishes files of different repositories.
+// The authors and the committers are named by the groupBy key, see Options.GroupBy.
+func (s *State) addTo(collector *stats.Collector, prefix, groupBy string) {
+	commits := make(map[string]*git.Commit, len(s.Commits))
+	for hash, c := range s.Commits {
+		commits[hash] = &git.Commit{Hash: hash, Author: c.name(false, groupBy), Committer: c.name(true, groupBy)}
+	}
+
+	for path, f := range s.Files {
+		if f.Last != "" {
+			collector.AddEmptyFile(prefix+path, commits[f.Last])
+		}
+		for hash, n := range f.Lines {
+			lines := stats.Lines{Comments: f.Comments[hash], Blank: f.Blank[hash]}
+			lines.Code = n - lines.Comments - lines.Blank
+			collector.AddLines(prefix+path, commits[hash], lines)
+		}
+	}
+
+	for _, hash := range s.LogCommits {
+		collector.AddLogCommit(commits[hash])
+	}
+}
+
+// ParseState reads the State written by State.Write.
+func ParseState(r io.Reader) (*State, error) {
+	var s State
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return nil, err
+	}
+	if s.Version != stateVersion {
+		return nil, fmt.Errorf("unsupported state version %d", s.Version)
+	}
+	if s.Revision == "" {
+		return nil, fmt.Errorf("state has no revision")
+	}
+
+	for path, f := range s.Files {
+		hashes := make([]string, 0, len(f.Lines)+1)
+		for hash := range f.Lines {
+			hashes = append(hashes, hash)
+		}
+		if f.Last != "" {
+			hashes = append(hashes, f.Last)
+		}
+		for _, hash := range hashes {
+			if _, ok := s.Commits[hash]; !ok {
+				return nil, fmt.Errorf("file %q: unknown commit %s", path, hash)
+			}
+		}
+
+		for hash, n := range f.Lines {
+			if f.Comments[hash]+f.Blank[hash] > n {
+				return nil, fmt.Errorf("file %q: commit %s has more comment and blank lines than lines", path, hash)
+			}
+		}
+		for _, m := range []map[string]int{f.Comments, f.Blank} {
+			for hash := range m {
+				if _, ok := f.Lines[hash]; !ok {
+					return nil, fmt.Errorf("file %q: commit %s has no lines", path, hash)
+				}
+			}
+		}
+	}
+
+	for _, hash := range s.LogCommits {
+		if _, ok := s.Commits[hash]; !ok {
+			return nil, fmt.Errorf("unknown log commit %s", hash)
+		}
+	}
+
+	return &s, nil
+}
+
+// LoadState reads the State from the file.
+func LoadState(path string) (*State, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	s, err := ParseState(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Write writes the State as json.
+func (s *State) Write(w io.Writer) error {
+	return json.NewEncoder(w).Encode(s)
+}
+
+// Save writes the State to the file, replacing it atomically.
+func (s *State) Save(path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	if err := s.Write(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// counted returns the number of lines of the commit of the kind counted with Options.Count.
+func (f FileState) counted(hash, count string) int {
+	switch count {
+	case CountCode:
+		return f.Lines[hash] - f.Comments[hash] - f.Blank[hash]
+	case CountComments:
+		return f.Comments[hash]
+	case CountBlank:
+		return f.Blank[hash]
+	default:
+		return f.Lines[hash]
+	}
+}
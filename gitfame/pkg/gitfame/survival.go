@@ -0,0 +1,340 @@
+package gitfame
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"gitlab.com/slon/shad-go/gitfame/internal/format"
+)
+
+// SurvivalPeriods are the periods of the cohorts supported by RunSurvival.
+var SurvivalPeriods = []string{PeriodMonth, PeriodQuarter, PeriodYear}
+
+// SurvivalOptions configure RunSurvival.
+type SurvivalOptions struct {
+	// Period is the length of the cohorts and the interval between the samples, PeriodQuarter by default.
+	Period string
+}
+
+// Kinds of SurvivalCurve.
+const (
+	SurvivalCohort = "cohort"
+	SurvivalAuthor = "author"
+	SurvivalTotal  = "total"
+)
+
+// SurvivalCurve is the estimated share of lines still present a number of periods after their introduction.
+type SurvivalCurve struct {
+	Kind string
+	// Name is the label of the cohort, the name of the author or empty for the total.
+	Name string
+	// Lines is the number of the introduced lines, the ones present at the ends of the periods of their commits.
+	Lines int
+	// Survival[k] is the share of the lines present k periods later, Survival[0] is 1.
+	Survival []float64
+	// HalfLife is the estimated number of periods it takes half of the lines to be gone, 0 if none are.
+	HalfLife float64
+}
+
+// Sample is a revision blamed by RunSurvival.
+type Sample struct {
+	// Period is the label of the period the revision ends.
+	Period string
+	// Revision is the hash of the last first-parent commit of the period.
+	Revision string
+	Time     time.Time
+}
+
+// SurvivalReport is the result of RunSurvival.
+type SurvivalReport struct {
+	// Report is the report of the analyzed revision, the last sample.
+	*Report
+	Period  string
+	Samples []Sample
+	// Curves are the curves of the cohorts from the oldest, of the authors by the introduced lines
+	// and the total one.
+	Curves []SurvivalCurve
+}
+
+// RunSurvival blames the ends of the periods in the first-parent history of the revision
+// and tracks how many lines introduced in each period survive at the later ones.
+//
+// Lines belong to the cohort of the period of the author time of their commits,
+// or of the committer time with Options.UseCommitter.
+// Authors are limited by Options.MinLines and Options.Top applied to the introduced lines.
+func RunSurvival(ctx context.Context, opts Options, survivalOpts SurvivalOptions) (*SurvivalReport, error) {
+	period := cmp.Or(survivalOpts.Period, PeriodQuarter)
+	if !slices.Contains(SurvivalPeriods, period) {
+		return nil, &OptionError{Option: "period", Err: fmt.Errorf("unknown period %q", period)}
+	}
+
+	opts.setDefaults()
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	if opts.PartialOK {
+		return nil, &OptionError{Option: "partial-ok", Err: errors.New("survival needs all samples blamed")}
+	}
+
+	// The samples are found in the log.
+	_, repo, err := opts.open()
+	if err != nil {
+		return nil, err
+	}
+	if repo == nil {
+		return nil, &OptionError{Option: "backend", Err: fmt.Errorf("survival requires the %s backend", BackendGit)}
+	}
+
+	revision, err := repo.ResolveRevision(ctx, opts.Revision)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := repo.FirstParents(ctx, revision)
+	if err != nil {
+		return nil, err
+	}
+
+	from, to := history[0].CommitterTime, history[0].CommitterTime
+	for _, c := range history {
+		from, to = minTime(from, c.CommitterTime), maxTime(to, c.CommitterTime)
+	}
+	starts := periods(from, to, period)
+
+	survival := &SurvivalReport{Period: period}
+	for i, start := range starts {
+		sample := Sample{Period: periodLabel(start, period), Revision: revision, Time: history[0].CommitterTime}
+		if i < len(starts)-1 {
+			end := nextPeriod(start, period)
+			for _, c := range history {
+				if c.CommitterTime.Before(end) {
+					sample.Revision, sample.Time = c.Hash, c.CommitterTime
+					break
+				}
+			}
+		}
+		survival.Samples = append(survival.Samples, sample)
+	}
+
+	// alive[name][c][k] is the number of lines of the author in cohort c present k periods after it.
+	alive := make(map[string]map[int][]int)
+	reports := make(map[string]*Report)
+	for s, sample := range survival.Samples {
+		report, ok := reports[sample.Revision]
+		if !ok {
+			sampleOpts := opts
+			sampleOpts.Revision = sample.Revision
+			if report, err = Run(ctx, sampleOpts); err != nil {
+				return nil, err
+			}
+			reports[sample.Revision] = report
+		}
+		survival.Report = report
+
+		for _, f := range report.State.Files {
+			for hash := range f.Lines {
+				commit := report.State.Commits[hash]
+				name, t := commit.Author, commit.AuthorTime
+				if opts.UseCommitter {
+					name, t = commit.Committer, commit.CommitterTime
+				}
+
+				// Commits dated after the sample are counted in its cohort.
+				c := sort.Search(len(starts), func(i int) bool { return starts[i].After(time.Unix(t, 0)) }) - 1
+				c = min(max(c, 0), s)
+
+				if alive[name] == nil {
+					alive[name] = make(map[int][]int)
+				}
+				if alive[name][c] == nil {
+					alive[name][c] = make([]int, len(starts)-c)
+				}
+				alive[name][c][s-c] += f.counted(hash, opts.Count)
+			}
+		}
+	}
+
+	for c, start := range starts {
+		var counts [][]int
+		for _, cohorts := range alive {
+			if n, ok := cohorts[c]; ok {
+				counts = append(counts, n)
+			}
+		}
+		if len(counts) > 0 {
+			curve := survivalCurve(counts)
+			curve.Kind, curve.Name = SurvivalCohort, periodLabel(start, period)
+			survival.Curves = append(survival.Curves, curve)
+		}
+	}
+
+	var authors []SurvivalCurve
+	for name, cohorts := range alive {
+		curve := survivalCurve(cohortCounts(cohorts))
+		curve.Kind, curve.Name = SurvivalAuthor, name
+		if curve.Lines >= opts.MinLines {
+			authors = append(authors, curve)
+		}
+	}
+	slices.SortFunc(authors, func(a, b SurvivalCurve) int {
+		return cmp.Or(cmp.Compare(b.Lines, a.Lines), cmp.Compare(a.Name, b.Name))
+	})
+
+	if opts.Top > 0 && len(authors) > opts.Top {
+		var counts [][]int
+		for _, a := range authors[opts.Top:] {
+			counts = append(counts, cohortCounts(alive[a.Name])...)
+		}
+		others := survivalCurve(counts)
+		others.Kind, others.Name = SurvivalAuthor, Others
+		authors = append(authors[:opts.Top], others)
+	}
+	survival.Curves = append(survival.Curves, authors...)
+
+	var counts [][]int
+	for _, cohorts := range alive {
+		counts = append(counts, cohortCounts(cohorts)...)
+	}
+	total := survivalCurve(counts)
+	total.Kind = SurvivalTotal
+	survival.Curves = append(survival.Curves, total)
+
+	return survival, nil
+}
+
+func cohortCounts(cohorts map[int][]int) [][]int {
+	counts := make([][]int, 0, len(cohorts))
+	for _, n := range cohorts {
+		counts = append(counts, n)
+	}
+	return counts
+}
+
+// survivalCurve estimates the survival of the lines of the cohorts, counts[i][k] being
+// the lines of cohort i present k periods after it.
+//
+// As in the Kaplan-Meier estimator, the share surviving from k-1 to k periods is taken
+// from the cohorts observed for k periods. Lines appearing late, e.g. merged from
+// a long-lived branch, do not raise the share.
+func survivalCurve(counts [][]int) SurvivalCurve {
+	var lines, ages int
+	for _, n := range counts {
+		lines += n[0]
+		ages = max(ages, len(n))
+	}
+
+	survival := []float64{1}
+	for k := 1; k < ages; k++ {
+		var before, after int
+		for _, n := range counts {
+			if len(n) > k {
+				before += n[k-1]
+				after += n[k]
+			}
+		}
+
+		share := survival[k-1]
+		if after < before {
+			share *= float64(after) / float64(before)
+		}
+		survival = append(survival, share)
+	}
+
+	return SurvivalCurve{Lines: lines, Survival: survival, HalfLife: halfLife(survival)}
+}
+
+// halfLife returns the number of periods it takes the survival to drop to a half,
+// interpolated linearly between the periods, or extrapolated exponentially from
+// the last one if the survival is above a half; 0 if nothing is gone.
+func halfLife(survival []float64) float64 {
+	for k := 1; k < len(survival); k++ {
+		if survival[k] <= 0.5 {
+			return float64(k-1) + (survival[k-1]-0.5)/(survival[k-1]-survival[k])
+		}
+	}
+
+	last := survival[len(survival)-1]
+	if last >= 1 {
+		return 0
+	}
+	return float64(len(survival)-1) * math.Log(0.5) / math.Log(last)
+}
+
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+// survivalRow is the json encoding of SurvivalCurve with the shares rounded to 3 digits.
+type survivalRow struct {
+	Kind     string    `json:"kind"`
+	Name     string    `json:"name"`
+	Lines    int       `json:"lines"`
+	HalfLife *float64  `json:"half_life"`
+	Survival []float64 `json:"survival"`
+}
+
+// WriteSurvival renders the report in the built-in output format: a row of the kind, the name,
+// the introduced lines, the half-life in periods and the shares surviving 0, 1, 2... periods per curve.
+func WriteSurvival(w io.Writer, name string, r *SurvivalReport) error {
+	if err := format.Validate(name); err != nil {
+		return &OptionError{Option: "format", Err: err}
+	}
+
+	header := []string{"Kind", "Name", "Lines", "Half-life"}
+	for k := range r.Samples {
+		header = append(header, strconv.Itoa(k)+periodUnit(r.Period))
+	}
+
+	rows := make([]survivalRow, 0, len(r.Curves))
+	for _, c := range r.Curves {
+		row := survivalRow{Kind: c.Kind, Name: c.Name, Lines: c.Lines}
+		if c.HalfLife > 0 {
+			halfLife := math.Round(c.HalfLife*1000) / 1000
+			row.HalfLife = &halfLife
+		}
+		for _, share := range c.Survival {
+			row.Survival = append(row.Survival, math.Round(share*1000)/1000)
+		}
+		rows = append(rows, row)
+	}
+
+	t := &format.Table[survivalRow]{
+		Header: header,
+		Items:  rows,
+		Record: func(row *survivalRow) []string {
+			halfLife := "-"
+			if row.HalfLife != nil {
+				halfLife = strconv.FormatFloat(*row.HalfLife, 'f', 1, 64)
+			}
+
+			record := []string{row.Kind, row.Name, strconv.Itoa(row.Lines), halfLife}
+			for _, share := range row.Survival {
+				record = append(record, strconv.FormatFloat(share, 'f', 2, 64))
+			}
+			// Csv readers expect the same number of fields in all records.
+			for len(record) < len(header) {
+				record = append(record, "")
+			}
+			return record
+		},
+	}
+	return t.Write(w, name)
+}
@@ -0,0 +1,91 @@
+package gitfame
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeriods(t *testing.T) {
+	// Sunday.
+	at := time.Date(2021, time.February, 28, 17, 54, 7, 0, time.UTC)
+
+	for _, tc := range []struct {
+		period string
+		start  time.Time
+		next   time.Time
+		label  string
+	}{
+		{PeriodWeek, time.Date(2021, time.February, 22, 0, 0, 0, 0, time.UTC), time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC), "2021-W08"},
+		{PeriodMonth, time.Date(2021, time.February, 1, 0, 0, 0, 0, time.UTC), time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC), "2021-02"},
+		{PeriodQuarter, time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC), time.Date(2021, time.April, 1, 0, 0, 0, 0, time.UTC), "2021-Q1"},
+		{PeriodYear, time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC), time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC), "2021"},
+	} {
+		t.Run(tc.period, func(t *testing.T) {
+			start := periodStart(at, tc.period)
+			require.Equal(t, tc.start, start)
+			require.Equal(t, tc.next, nextPeriod(start, tc.period))
+			require.Equal(t, tc.label, periodLabel(start, tc.period))
+		})
+	}
+
+	require.Len(t, periods(at, at.AddDate(1, 0, 0), PeriodQuarter), 5)
+}
+
+func TestSurvivalCurve(t *testing.T) {
+	curve := survivalCurve([][]int{
+		{100, 80, 40},
+		{50, 25},
+		{10},
+	})
+	require.Equal(t, 160, curve.Lines)
+	require.Equal(t, []float64{1, 0.7, 0.35}, curve.Survival)
+	require.InDelta(t, 1+0.2/0.35, curve.HalfLife, 1e-9)
+
+	// Lines merged late do not raise the survival.
+	curve = survivalCurve([][]int{{0, 10, 5}})
+	require.Equal(t, []float64{1, 1, 0.5}, curve.Survival)
+	require.InDelta(t, 2, curve.HalfLife, 1e-9)
+
+	require.Zero(t, halfLife([]float64{1, 1}))
+	require.InDelta(t, 1.75, halfLife([]float64{1, 0.8, 0.4}), 1e-9)
+	require.InDelta(t, 2, halfLife([]float64{1, math.Sqrt(0.5)}), 1e-9, "extrapolated")
+}
+
+func TestRunSurvival(t *testing.T) {
+	dir := cloneBundle(t, "go-cmp.bundle")
+
+	report, err := RunSurvival(context.Background(), Options{Repository: dir, Top: 2}, SurvivalOptions{Period: PeriodYear})
+	require.NoError(t, err)
+	require.Len(t, report.Revision, 40)
+	require.Len(t, report.Samples, 5)
+	require.Equal(t, report.Revision, report.Samples[4].Revision)
+
+	var names []string
+	for _, c := range report.Curves {
+		names = append(names, c.Kind+" "+c.Name)
+		require.Equal(t, 1.0, c.Survival[0])
+	}
+	require.Equal(t, []string{
+		"cohort 2017", "cohort 2018", "cohort 2019", "cohort 2020", "cohort 2021",
+		"author Joe Tsai", "author colinnewell", "author " + Others,
+		"total ",
+	}, names)
+
+	total := report.Curves[len(report.Curves)-1]
+	require.Equal(t, 17900, total.Lines)
+	require.Len(t, total.Survival, 5)
+	require.Less(t, total.Survival[4], total.Survival[1])
+
+	_, err = RunSurvival(context.Background(), Options{Repository: dir}, SurvivalOptions{Period: PeriodWeek})
+	var optionErr *OptionError
+	require.ErrorAs(t, err, &optionErr)
+	require.Equal(t, "period", optionErr.Option)
+
+	_, err = RunSurvival(context.Background(), Options{Repository: dir, Backend: BackendGoGit}, SurvivalOptions{})
+	require.ErrorAs(t, err, &optionErr)
+	require.Equal(t, "backend", optionErr.Option)
+}
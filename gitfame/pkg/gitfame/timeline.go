@@ -0,0 +1,225 @@
+package gitfame
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/slon/shad-go/gitfame/internal/format"
+)
+
+// TimelinePeriods are the periods supported by RunTimeline.
+var TimelinePeriods = []string{PeriodWeek, PeriodMonth}
+
+// TimelineOptions configure RunTimeline.
+type TimelineOptions struct {
+	// Period is the length of the buckets of the commits, PeriodMonth by default.
+	Period string
+}
+
+// TimelineReport is the result of RunTimeline.
+type TimelineReport struct {
+	// Revision is the hash of the analyzed commit.
+	Revision string
+	Period   string
+	// Periods are the labels of the periods from the first counted commit to the last one.
+	Periods []string
+	// Authors are sorted by the number of commits.
+	Authors  []AuthorTimeline
+	Warnings []string
+}
+
+// AuthorTimeline holds the numbers of commits of an author by period.
+type AuthorTimeline struct {
+	Name    string
+	Commits int
+	// Counts are the numbers of commits in each of TimelineReport.Periods.
+	Counts []int
+}
+
+// RunTimeline counts the non-merge commits of the authors in the history of the revision by period.
+//
+// Only commits modifying files selected by the options count; the files are matched by their paths
+// at the commits, so files deleted by the revision count too. Commits are dated by the author time,
+// or by the committer time with Options.UseCommitter. Options.Top folds the authors with fewer commits.
+func RunTimeline(ctx context.Context, opts Options, timelineOpts TimelineOptions) (*TimelineReport, error) {
+	period := cmp.Or(timelineOpts.Period, PeriodMonth)
+	if !slices.Contains(TimelinePeriods, period) {
+		return nil, &OptionError{Option: "period", Err: fmt.Errorf("unknown period %q", period)}
+	}
+
+	opts.setDefaults()
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	var warnings Report
+	f, _, err := newFilter(&opts, &warnings)
+	if err != nil {
+		return nil, err
+	}
+
+	// The commits are read from the log.
+	_, repo, err := opts.open()
+	if err != nil {
+		return nil, err
+	}
+	if repo == nil {
+		return nil, &OptionError{Option: "backend", Err: fmt.Errorf("timeline requires the %s backend", BackendGit)}
+	}
+
+	timeline := &TimelineReport{Period: period, Warnings: warnings.Warnings}
+	if timeline.Revision, err = repo.ResolveRevision(ctx, opts.Revision); err != nil {
+		return nil, err
+	}
+
+	entries, err := repo.Log(ctx, timeline.Revision, opts.Paths...)
+	if err != nil {
+		return nil, err
+	}
+
+	var excluder *commitExcluder
+	if opts.ExcludeCommitMessage != "" {
+		excluder = newCommitExcluder(ctx, repo, timeline.Revision, regexp.MustCompile(opts.ExcludeCommitMessage), opts.ExcludeMode)
+		defer func() { _ = excluder.Close() }()
+	}
+
+	// times are the dates of the counted commits by author.
+	times := make(map[string][]time.Time)
+	var from, to time.Time
+	for _, e := range entries {
+		if !slices.ContainsFunc(e.Files, f.Match) {
+			continue
+		}
+
+		if excluder != nil {
+			excluded, err := excluder.isExcluded(e.Commit.Hash)
+			if err != nil {
+				return nil, err
+			}
+			if excluded {
+				continue
+			}
+		}
+
+		name, t := e.Commit.Author, e.Commit.AuthorTime
+		if opts.UseCommitter {
+			name, t = e.Commit.Committer, e.Commit.CommitterTime
+		}
+		times[name] = append(times[name], t)
+
+		if from.IsZero() || t.Before(from) {
+			from = t
+		}
+		if t.After(to) {
+			to = t
+		}
+	}
+
+	if len(times) == 0 {
+		return timeline, nil
+	}
+
+	index := make(map[string]int)
+	for _, start := range periods(from, to, period) {
+		index[periodLabel(start, period)] = len(timeline.Periods)
+		timeline.Periods = append(timeline.Periods, periodLabel(start, period))
+	}
+
+	for name, dates := range times {
+		a := AuthorTimeline{Name: name, Commits: len(dates), Counts: make([]int, len(timeline.Periods))}
+		for _, t := range dates {
+			a.Counts[index[periodLabel(periodStart(t, period), period)]]++
+		}
+		timeline.Authors = append(timeline.Authors, a)
+	}
+	slices.SortFunc(timeline.Authors, func(a, b AuthorTimeline) int {
+		return cmp.Or(cmp.Compare(b.Commits, a.Commits), cmp.Compare(a.Name, b.Name))
+	})
+
+	if opts.Top > 0 && len(timeline.Authors) > opts.Top {
+		others := AuthorTimeline{Name: Others, Counts: make([]int, len(timeline.Periods))}
+		for _, a := range timeline.Authors[opts.Top:] {
+			others.Commits += a.Commits
+			for i, n := range a.Counts {
+				others.Counts[i] += n
+			}
+		}
+		timeline.Authors = append(timeline.Authors[:opts.Top], others)
+	}
+
+	return timeline, nil
+}
+
+// timelineRow is a row of the long format of TimelineReport.
+type timelineRow struct {
+	Period  string `json:"period"`
+	Name    string `json:"name"`
+	Commits int    `json:"commits"`
+}
+
+// WriteTimeline renders the report in the built-in output format in the long format:
+// a row of the period, the name and the commits per author and period, the periods with
+// no commits of the author included.
+func WriteTimeline(w io.Writer, name string, r *TimelineReport) error {
+	if err := format.Validate(name); err != nil {
+		return &OptionError{Option: "format", Err: err}
+	}
+
+	var rows []timelineRow
+	for i, period := range r.Periods {
+		for _, a := range r.Authors {
+			rows = append(rows, timelineRow{Period: period, Name: a.Name, Commits: a.Counts[i]})
+		}
+	}
+
+	t := &format.Table[timelineRow]{
+		Header: []string{"Period", "Name", "Commits"},
+		Items:  rows,
+		Record: func(row *timelineRow) []string {
+			return []string{row.Period, row.Name, strconv.Itoa(row.Commits)}
+		},
+	}
+	return t.Write(w, name)
+}
+
+// sparkLevels are the ASCII characters of the sparklines from no commits to the most ones.
+const sparkLevels = "_.:-=+*#%@"
+
+// WriteSparklines renders the report as a table of the name, the commits
+// and an ASCII sparkline of the commits by period per author.
+//
+// Each sparkline is scaled to the most commits of the author in a period.
+func WriteSparklines(w io.Writer, r *TimelineReport) error {
+	header := []string{"Name", "Commits", "Timeline"}
+	if len(r.Periods) > 0 {
+		header[2] = r.Periods[0] + ".." + r.Periods[len(r.Periods)-1]
+	}
+
+	t := &format.Table[AuthorTimeline]{
+		Header: header,
+		Items:  r.Authors,
+		Record: func(a *AuthorTimeline) []string {
+			return []string{a.Name, strconv.Itoa(a.Commits), sparkline(a.Counts)}
+		},
+	}
+	return t.Write(w, format.Tabular)
+}
+
+// sparkline draws the counts with sparkLevels.
+func sparkline(counts []int) string {
+	most := slices.Max(counts)
+
+	var b strings.Builder
+	for _, n := range counts {
+		// Rounded up for the least commits to be above none.
+		b.WriteByte(sparkLevels[(n*(len(sparkLevels)-1)+most-1)/most])
+	}
+	return b.String()
+}
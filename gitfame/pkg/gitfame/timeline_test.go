@@ -0,0 +1,58 @@
+package gitfame
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSparkline(t *testing.T) {
+	require.Equal(t, "_.@", sparkline([]int{0, 1, 100}))
+	require.Equal(t, "@_@", sparkline([]int{1, 0, 1}))
+	require.Equal(t, "_:=*@", sparkline([]int{0, 2, 4, 6, 9}))
+}
+
+func TestRunTimeline(t *testing.T) {
+	dir := cloneBundle(t, "go-cmp.bundle")
+
+	report, err := RunTimeline(context.Background(), Options{Repository: dir, Top: 1}, TimelineOptions{})
+	require.NoError(t, err)
+	require.Len(t, report.Revision, 40)
+	require.Equal(t, "2017-07", report.Periods[0])
+	require.Equal(t, "2021-02", report.Periods[len(report.Periods)-1])
+
+	require.Len(t, report.Authors, 2)
+	require.Equal(t, "Joe Tsai", report.Authors[0].Name)
+	require.Equal(t, 111, report.Authors[0].Commits)
+	require.Equal(t, Others, report.Authors[1].Name)
+	for _, a := range report.Authors {
+		var commits int
+		for _, n := range a.Counts {
+			commits += n
+		}
+		require.Equal(t, a.Commits, commits)
+	}
+
+	paths, err := RunTimeline(context.Background(), Options{Repository: dir, Paths: []string{"cmp/cmpopts"}, Top: 1},
+		TimelineOptions{Period: PeriodWeek})
+	require.NoError(t, err)
+	require.Equal(t, "2017-W28", paths.Periods[0])
+	require.Less(t, paths.Authors[0].Commits, report.Authors[0].Commits)
+
+	var out bytes.Buffer
+	require.NoError(t, WriteTimeline(&out, FormatCSV, paths))
+	require.True(t, strings.HasPrefix(out.String(), "Period,Name,Commits\n2017-W28,Joe Tsai,1\n2017-W28,(others),0\n2017-W29,"), out.String())
+
+	none, err := RunTimeline(context.Background(), Options{Repository: dir, Extensions: []string{".zzz"}}, TimelineOptions{})
+	require.NoError(t, err)
+	require.Empty(t, none.Periods)
+	require.Empty(t, none.Authors)
+
+	_, err = RunTimeline(context.Background(), Options{Repository: dir}, TimelineOptions{Period: PeriodQuarter})
+	var optionErr *OptionError
+	require.ErrorAs(t, err, &optionErr)
+	require.Equal(t, "period", optionErr.Option)
+}
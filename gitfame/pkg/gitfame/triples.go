@@ -0,0 +1,126 @@
+package gitfame
+
+import (
+	"cmp"
+	"errors"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gitlab.com/slon/shad-go/gitfame/internal/format"
+)
+
+// FormatMatrixCSV is the csv format of NewTriplesWriter, accepted by NewWriter.
+const FormatMatrixCSV = "matrix-csv"
+
+// Triple is the attribution of the lines of a file to an author.
+type Triple struct {
+	// File is relative to Report.StripPrefix and prefixed with the repository name
+	// and a colon for several repositories.
+	File  string `json:"file"`
+	Name  string `json:"name"`
+	Lines int    `json:"lines"`
+	// Commits are the hashes of the commits of the author that last modified the lines, sorted.
+	Commits []string `json:"commits"`
+}
+
+// Triples returns a triple per file and author of the report, sorted by file and by lines.
+//
+// Lines are counted as Author.Lines, authors are folded and dropped as Report.Authors.
+// Empty files have a triple of no lines of the author of their last commit.
+// The lines and the triples of an author add up to Author.Lines and Author.Files.
+func Triples(r *Report) []Triple {
+	// names are the rows of the authors in the report.
+	names := make(map[string]string, len(r.Authors)+len(r.Folded))
+	for _, a := range r.Authors {
+		names[a.Name] = a.Name
+	}
+	for _, name := range r.Folded {
+		names[name] = Others
+	}
+
+	repos := r.Repositories
+	if repos == nil && r.State != nil {
+		repos = []RepositoryReport{{Report: r}}
+	}
+
+	var triples []Triple
+	for _, repo := range repos {
+		state := repo.State
+		for path, f := range state.Files {
+			path = strings.TrimPrefix(path, r.StripPrefix)
+			if len(repos) > 1 {
+				path = repo.Name + ":" + path
+			}
+
+			byName := make(map[string]*Triple)
+			add := func(hash string, lines int) {
+				name, ok := names[state.Commits[hash].name(r.UseCommitter, r.GroupBy)]
+				if !ok {
+					// The author is dropped by Options.MinLines.
+					return
+				}
+
+				t, ok := byName[name]
+				if !ok {
+					t = &Triple{File: path, Name: name}
+					byName[name] = t
+				}
+				t.Lines += lines
+				if !slices.Contains(t.Commits, hash) {
+					t.Commits = append(t.Commits, hash)
+				}
+			}
+
+			if f.Last != "" {
+				add(f.Last, 0)
+			}
+			for hash := range f.Lines {
+				add(hash, f.counted(hash, r.Count))
+			}
+
+			for _, t := range byName {
+				slices.Sort(t.Commits)
+				triples = append(triples, *t)
+			}
+		}
+	}
+
+	slices.SortFunc(triples, func(a, b Triple) int {
+		return cmp.Or(cmp.Compare(a.File, b.File), cmp.Compare(b.Lines, a.Lines), cmp.Compare(a.Name, b.Name))
+	})
+	return triples
+}
+
+// NewTriplesWriter returns the Writer of the built-in output format
+// emitting the Triples of the report instead of the authors.
+//
+// Every row holds the file, the name, the lines and the commits separated by spaces.
+// WithColumns is not supported.
+func NewTriplesWriter(name string, opts ...WriterOption) (Writer, error) {
+	if err := format.Validate(name); err != nil {
+		return nil, &OptionError{Option: "format", Err: err}
+	}
+
+	o, err := newWriterOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(o.columns) > 0 {
+		return nil, &OptionError{Option: "columns", Err: errors.New("columns are not supported by triples")}
+	}
+
+	return WriterFunc(func(w io.Writer, r *Report) error {
+		t := &format.Table[Triple]{
+			Header: []string{"File", "Name", "Lines", "Commits"},
+			Key:    "triples",
+			Items:  Triples(r),
+			Record: func(t *Triple) []string {
+				return []string{t.File, t.Name, strconv.Itoa(t.Lines), strings.Join(t.Commits, " ")}
+			},
+			Metadata: o.metadataOf(r),
+		}
+		return t.Write(w, name)
+	}), nil
+}
@@ -0,0 +1,67 @@
+package gitfame
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTriples(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		bundle string
+		opts   Options
+	}{
+		{name: "all", bundle: "simple.bundle", opts: Options{Revision: "v1.0"}},
+		{name: "count code", bundle: "simple.bundle", opts: Options{Revision: "v1.0", Count: CountCode}},
+		{name: "empty files", bundle: "breaker.bundle", opts: Options{Revision: "HEAD"}},
+		{name: "top", bundle: "breaker.bundle", opts: Options{Revision: "HEAD", Top: 1}},
+		{name: "min lines", bundle: "breaker.bundle", opts: Options{Revision: "HEAD", MinLines: 5}},
+		{name: "committers", bundle: "simple.bundle", opts: Options{Revision: "v1.0", UseCommitter: true}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.opts.backend = replay(t, tc.bundle, tc.opts.Revision)
+
+			report, err := Run(context.Background(), tc.opts)
+			require.NoError(t, err)
+
+			lines := make(map[string]int)
+			files := make(map[string]int)
+			for _, triple := range Triples(report) {
+				lines[triple.Name] += triple.Lines
+				files[triple.Name]++
+				require.NotEmpty(t, triple.Commits)
+			}
+
+			require.Len(t, files, len(report.Authors))
+			for _, a := range report.Authors {
+				require.Equal(t, a.Lines, lines[a.Name], a.Name)
+				require.Equal(t, a.Files, files[a.Name], a.Name)
+			}
+		})
+	}
+}
+
+func TestTriplesWriter(t *testing.T) {
+	report, err := Run(context.Background(), Options{Revision: "v1.0", backend: replay(t, "simple.bundle", "v1.0")})
+	require.NoError(t, err)
+
+	w, err := NewWriter(FormatMatrixCSV)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, w.Write(&out, report))
+	require.Equal(t, `File,Name,Lines,Commits
+doc.go,Brad Fitzpatrick,1,9db7731746bfc069375e397f0d56c0c11396b421
+features.md,Rob Pike,5,f4d5081f2c3f447e54bc5e74ea177f6d486efaac
+hello.go,Rob Pike,7,00a6a716ebbf3841b57003dd470b8c31fab4be2b 138c45422c22ec37a4ce1feb47ba3c68d5079b2a
+readme.md,Rob Pike,0,138c45422c22ec37a4ce1feb47ba3c68d5079b2a
+`, out.String())
+
+	_, err = NewTriplesWriter(FormatCSV, WithColumns(ColumnCode))
+	var optionErr *OptionError
+	require.ErrorAs(t, err, &optionErr)
+	require.Equal(t, "columns", optionErr.Option)
+}
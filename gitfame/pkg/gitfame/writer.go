@@ -0,0 +1,242 @@
+package gitfame
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gitlab.com/slon/shad-go/gitfame/internal/format"
+)
+
+// Output formats supported by NewWriter.
+const (
+	FormatTabular   = format.Tabular
+	FormatCSV       = format.CSV
+	FormatJSON      = format.JSON
+	FormatJSONLines = format.JSONLines
+)
+
+// Formats lists output formats supported by NewWriter.
+func Formats() []string {
+	return append([]string(nil), format.Formats...)
+}
+
+// Writer renders a report.
+type Writer interface {
+	Write(w io.Writer, r *Report) error
+}
+
+// WriterFunc adapts a function to the Writer interface.
+type WriterFunc func(w io.Writer, r *Report) error
+
+// Write calls f(w, r).
+func (f WriterFunc) Write(w io.Writer, r *Report) error {
+	return f(w, r)
+}
+
+// WriterOption configures writers returned by NewWriter and NewRepositoriesWriter.
+type WriterOption func(*writerOptions)
+
+type writerOptions struct {
+	metadata bool
+	columns  []string
+}
+
+// Extra columns of the authors.
+const (
+	ColumnCode     = "code"
+	ColumnComments = "comments"
+	ColumnBlank    = "blank"
+)
+
+// Columns lists extra columns supported by WithColumns.
+var Columns = []string{ColumnCode, ColumnComments, ColumnBlank}
+
+// WithMetadata makes json formats describe how the report was calculated.
+//
+// The json format writes an object with the metadata and authors fields
+// instead of the array of authors, json-lines writes a line with the metadata
+// field before the authors. Other formats are not affected.
+func WithMetadata() WriterOption {
+	return func(o *writerOptions) { o.metadata = true }
+}
+
+// WithColumns appends the columns breaking the lines of the authors down by kind
+// in the given order, see Options.Classify. The json formats add the fields
+// of the same names.
+func WithColumns(columns ...string) WriterOption {
+	return func(o *writerOptions) { o.columns = append(o.columns, columns...) }
+}
+
+// Metadata describes how a report was calculated.
+type Metadata struct {
+	// Revision is empty for reports of several repositories.
+	Revision    string `json:"revision,omitempty"`
+	CommitsFrom string `json:"commits_from"`
+	// Count is the kind of the counted lines, see Options.Count.
+	Count string `json:"count"`
+	// Authors is the number of the authors in the report, the Others row included.
+	Authors int `json:"authors"`
+	// Skipped is the number of files excluded from blame, see Report.Skipped.
+	Skipped int `json:"skipped"`
+	// Partial marks reports of the files blamed before the run was interrupted, see Report.Partial.
+	Partial bool `json:"partial"`
+}
+
+func newWriterOptions(opts []WriterOption) (*writerOptions, error) {
+	o := &writerOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	seen := make(map[string]bool)
+	for _, c := range o.columns {
+		if !slices.Contains(Columns, c) {
+			return nil, &OptionError{Option: "columns", Err: fmt.Errorf("unknown column %q", c)}
+		}
+		if seen[c] {
+			return nil, &OptionError{Option: "columns", Err: fmt.Errorf("duplicate column %q", c)}
+		}
+		seen[c] = true
+	}
+
+	return o, nil
+}
+
+func (o *writerOptions) metadataOf(r *Report) any {
+	if !o.metadata {
+		return nil
+	}
+	return &Metadata{Revision: r.Revision, CommitsFrom: r.CommitsFrom, Count: r.Count, Authors: len(r.Authors), Skipped: len(r.Skipped), Partial: r.Partial}
+}
+
+// NewWriter returns the Writer of the built-in output format
+// or of FormatMatrixCSV, the csv format of NewTriplesWriter.
+func NewWriter(name string, opts ...WriterOption) (Writer, error) {
+	if name == FormatMatrixCSV {
+		return NewTriplesWriter(FormatCSV, opts...)
+	}
+
+	if err := format.Validate(name); err != nil {
+		return nil, &OptionError{Option: "format", Err: err}
+	}
+
+	o, err := newWriterOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return WriterFunc(func(w io.Writer, r *Report) error {
+		t := authorsTable(r, o.columns)
+		t.Metadata = o.metadataOf(r)
+		return t.Write(w, name)
+	}), nil
+}
+
+// NewRepositoriesWriter returns the Writer of the built-in output format
+// breaking the authors down by repository, see RunRepositories.
+//
+// Every row holds the repository name followed by the statistics of a single author.
+func NewRepositoriesWriter(name string, opts ...WriterOption) (Writer, error) {
+	if err := format.Validate(name); err != nil {
+		return nil, &OptionError{Option: "format", Err: err}
+	}
+
+	o, err := newWriterOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return WriterFunc(func(w io.Writer, r *Report) error {
+		t := repositoriesTable(r, o.columns)
+		t.Metadata = o.metadataOf(r)
+		return t.Write(w, name)
+	}), nil
+}
+
+// authorColumns is an author with the extra columns, json encodes the selected ones only.
+type authorColumns struct {
+	Author
+	Code     *int `json:"code,omitempty"`
+	Comments *int `json:"comments,omitempty"`
+	Blank    *int `json:"blank,omitempty"`
+}
+
+func withColumns(a Author, columns []string) authorColumns {
+	row := authorColumns{Author: a}
+	for _, c := range columns {
+		switch c {
+		case ColumnCode:
+			row.Code = &a.Code
+		case ColumnComments:
+			row.Comments = &a.Comments
+		case ColumnBlank:
+			row.Blank = &a.Blank
+		}
+	}
+	return row
+}
+
+func columnsHeader(columns []string) []string {
+	header := make([]string, 0, len(columns))
+	for _, c := range columns {
+		header = append(header, strings.ToUpper(c[:1])+c[1:])
+	}
+	return header
+}
+
+func (a *authorColumns) record(columns []string) []string {
+	record := []string{a.Name, strconv.Itoa(a.Lines), strconv.Itoa(a.Commits), strconv.Itoa(a.Files)}
+	for _, c := range columns {
+		switch c {
+		case ColumnCode:
+			record = append(record, strconv.Itoa(a.Author.Code))
+		case ColumnComments:
+			record = append(record, strconv.Itoa(a.Author.Comments))
+		case ColumnBlank:
+			record = append(record, strconv.Itoa(a.Author.Blank))
+		}
+	}
+	return record
+}
+
+func authorsTable(r *Report, columns []string) *format.Table[authorColumns] {
+	var rows []authorColumns
+	for _, a := range r.Authors {
+		rows = append(rows, withColumns(a, columns))
+	}
+
+	return &format.Table[authorColumns]{
+		Header: append([]string{"Name", "Lines", "Commits", "Files"}, columnsHeader(columns)...),
+		Key:    "authors",
+		Items:  rows,
+		Record: func(a *authorColumns) []string {
+			return a.record(columns)
+		},
+	}
+}
+
+type repositoryAuthor struct {
+	Repository string `json:"repository"`
+	authorColumns
+}
+
+func repositoriesTable(r *Report, columns []string) *format.Table[repositoryAuthor] {
+	var rows []repositoryAuthor
+	for _, repo := range r.Repositories {
+		for _, a := range repo.Authors {
+			rows = append(rows, repositoryAuthor{Repository: repo.Name, authorColumns: withColumns(a, columns)})
+		}
+	}
+
+	return &format.Table[repositoryAuthor]{
+		Header: append([]string{"Repository", "Name", "Lines", "Commits", "Files"}, columnsHeader(columns)...),
+		Key:    "authors",
+		Items:  rows,
+		Record: func(a *repositoryAuthor) []string {
+			return append([]string{a.Repository}, a.record(columns)...)
+		},
+	}
+}
@@ -60,8 +60,11 @@ func TestGitFame(t *testing.T) {
 				CompareResults(t, tc.Expected, output, tc.Format)
 			} else {
 				require.Error(t, err)
-				_, ok := err.(*exec.ExitError)
+				exitErr, ok := err.(*exec.ExitError)
 				require.True(t, ok)
+				if tc.ExitCode != 0 {
+					require.Equal(t, tc.ExitCode, exitErr.ExitCode())
+				}
 			}
 
 			newHEADRef := GetHEADRef(t, dir)
@@ -119,6 +122,8 @@ type TestDescription struct {
 	Bundle string   `yaml:"bundle"`
 	Error  bool     `yaml:"error"`
 	Format string   `yaml:"format,omitempty"`
+	// ExitCode is the expected exit code of a failed run, unchecked if zero.
+	ExitCode int `yaml:"exit_code,omitempty"`
 }
 
 func ReadTestDescription(t *testing.T, path string) *TestDescription {